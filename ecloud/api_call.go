@@ -99,8 +99,13 @@ func (c *Client) CreateCompute(reqBody schema.CreateComputeRequest) (*schema.Cre
 
 // Compute instances status
 func (c *Client) GetCompute() (*schema.GetComputeResponse, error) {
+	return c.GetComputeWithOpts(ListOpts{})
+}
+
+// Compute instances status, filtered server-side when supported
+func (c *Client) GetComputeWithOpts(opts ListOpts) (*schema.GetComputeResponse, error) {
 	var res schema.GetComputeResponse
-	err := c.CallAPI("GET", "17777", "/api/v1.0/client/vm/status", nil, &res, true)
+	err := c.CallAPI("GET", "17777", c.listPath("/api/v1.0/client/vm/status", opts), nil, &res, true)
 	if err != nil {
 		return nil, err
 	}
@@ -176,7 +181,7 @@ func (c *Client) CreateStorageImage(reqBody schema.CreateStorageImageRequest) (*
 }
 
 // Create new cloudinit volume
-func (c *Client) CreateStorageCloudInit(reqBody schema.CreateStorageCloudInitRequest, userData string) (*schema.CreateStorageCloudInitResponse, error) {
+func (c *Client) CreateStorageCloudInit(reqBody schema.CreateStorageCloudInitRequest, content string) (*schema.CreateStorageCloudInitResponse, error) {
 	var res schema.CreateStorageCloudInitResponse
 
 	fmt.Printf("Marshalling request body: %+v\n", reqBody)
@@ -187,39 +192,25 @@ func (c *Client) CreateStorageCloudInit(reqBody schema.CreateStorageCloudInitReq
 	encodedPayload := base64.StdEncoding.EncodeToString(jsonBytes)
 	fmt.Printf("Encoded payload (base64): %s\n", encodedPayload)
 
-	// -------------- CLOUD-INIT USER-DATA MODIFICATION --------------
-	// Use the embedded user-data template from cloudconfig package
-	modifiedContent := CloudinitTemplate
-	if reqBody.Name != "" {
-		hostname := strings.TrimSuffix(reqBody.Name, "-cloudinit")
-		modifiedContent = strings.Replace(modifiedContent, "hostname: myhost", "hostname: "+hostname, 1)
-		fmt.Printf("Replaced hostname with: %s\n", hostname)
-	}
-
-	// Inject userData into the template by replacing the "data" placeholder
-	if userData != "" {
-		modifiedContent = injectUserDataIntoTemplate(modifiedContent, userData)
-		fmt.Printf("Injected userData into template\n")
-	}
-
+	// -------------- CLOUD-INIT USER-DATA UPLOAD --------------
+	// content is the user-data already rendered, see renderCloudInit
 	// Create multipart form
 	var requestBody bytes.Buffer
 	writer := multipart.NewWriter(&requestBody)
 
-	// Add file field - using the modified content
+	// Add file field - using the rendered content
 	fileWriter, err := writer.CreateFormFile("file", "user-data")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create form file: %w", err)
 	}
 
-	// Write the modified content instead of copying from file
-	_, err = fileWriter.Write([]byte(modifiedContent))
+	_, err = fileWriter.Write([]byte(content))
 	if err != nil {
-		return nil, fmt.Errorf("failed to write modified content: %w", err)
+		return nil, fmt.Errorf("failed to write user-data content: %w", err)
 	}
 
 	writer.Close()
-	// ------------- END cloud-init user-data modification -------------
+	// ------------- END cloud-init user-data upload -------------
 
 	// Build URL for the request
 	url := c.endpoint + ":27777/api/v1.0/client/volume/cloudinit/metadata/" + encodedPayload
@@ -328,10 +319,93 @@ func (c *Client) FeedFileIntoCloudInitStorage(reqBody schema.FeedFileIntoCloudIn
 	}
 }
 
+// Create a new volume from the first chunk of an uploaded image
+func (c *Client) CreateStorageUpload(reqBody schema.CreateStorageUploadRequest, chunk []byte) (*schema.CreateStorageUploadResponse, error) {
+	if err := c.requireCapability(CapabilityVolumeUpload); err != nil {
+		return nil, err
+	}
+	var res schema.CreateStorageUploadResponse
+	resp, err := c.postChunk("/api/v1.0/client/volume/image/upload/", reqBody, chunk)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &res, nil
+}
+
+// Feed a further chunk of an uploaded image into its volume, "CONTINUE" is
+// returned until the last chunk is received
+func (c *Client) FeedStorageUpload(reqBody schema.FeedStorageUploadRequest, chunk []byte) (string, error) {
+	if err := c.requireCapability(CapabilityVolumeUpload); err != nil {
+		return "", err
+	}
+	resp, err := c.postChunk("/api/v1.0/client/volume/image/upload/", reqBody, chunk)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return "CONTINUE", nil
+	case http.StatusOK:
+		return "OK", nil
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return "", &APIError{StatusCode: resp.StatusCode, Message: string(body)}
+	}
+}
+
+// postChunk posts chunk as a multipart file to the storage daemon, with the
+// request body encoded in base64 as last path segment
+func (c *Client) postChunk(path string, reqBody interface{}, chunk []byte) (*http.Response, error) {
+	jsonBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reqBody: %w", err)
+	}
+	encodedPayload := base64.StdEncoding.EncodeToString(jsonBytes)
+
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	fileWriter, err := writer.CreateFormFile("file", "chunk")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := fileWriter.Write(chunk); err != nil {
+		return nil, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	writer.Close()
+
+	req, err := http.NewRequest("POST", c.endpoint+":27777"+path+encodedPayload, &requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return resp, nil
+}
+
 // Get storages
 func (c *Client) GetStorage() (*schema.GetStorageResponse, error) {
+	return c.GetStorageWithOpts(ListOpts{})
+}
+
+// Get storages, filtered server-side when supported
+func (c *Client) GetStorageWithOpts(opts ListOpts) (*schema.GetStorageResponse, error) {
 	var res schema.GetStorageResponse
-	err := c.CallAPI("GET", "27777", "/api/v1.0/client/volume/accessible", nil, &res, true)
+	err := c.CallAPI("GET", "27777", c.listPath("/api/v1.0/client/volume/accessible", opts), nil, &res, true)
 	if err != nil {
 		return nil, err
 	}
@@ -351,7 +425,46 @@ func (c *Client) GetStorageByID(reqBody schema.GetStorageByIDRequest) (*schema.G
 // Delete a storage volume
 func (c *Client) DeleteStorage(reqBody schema.DeleteStorageRequest) (*schema.DeleteStorageResponse, error) {
 	var res schema.DeleteStorageResponse
-	err := c.CallAPI("POST", "27777", "/api/v1.0/client/volume/delete", reqBody, &res, true)
+	err := c.CallAPI("POST", "27777", "/api/v1.0/client/volume/destroy", reqBody, &res, true)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Resize a storage volume
+func (c *Client) ResizeStorage(reqBody schema.ResizeStorageRequest) (*schema.ResizeStorageResponse, error) {
+	if err := c.requireCapability(CapabilityVolumeResize); err != nil {
+		return nil, err
+	}
+	var res schema.ResizeStorageResponse
+	err := c.CallAPI("POST", "27777", "/api/v1.0/client/volume/resize", reqBody, &res, true)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Clone a storage volume with its clone algorithm
+func (c *Client) CloneStorage(reqBody schema.CloneStorageRequest) (*schema.CloneStorageResponse, error) {
+	if err := c.requireCapability(CapabilityVolumeClone); err != nil {
+		return nil, err
+	}
+	var res schema.CloneStorageResponse
+	err := c.CallAPI("POST", "27777", "/api/v1.0/client/volume/clone", reqBody, &res, true)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Export a storage volume, making its image downloadable
+func (c *Client) ExportStorage(reqBody schema.ExportStorageRequest) (*schema.ExportStorageResponse, error) {
+	if err := c.requireCapability(CapabilityVolumeExport); err != nil {
+		return nil, err
+	}
+	var res schema.ExportStorageResponse
+	err := c.CallAPI("POST", "27777", "/api/v1.0/client/volume/export", reqBody, &res, true)
 	if err != nil {
 		return nil, err
 	}
@@ -373,9 +486,14 @@ func (c *Client) GetNetworkByID(reqBody schema.GetNetworkByIDRequest) (*schema.G
 
 // List all networks
 func (c *Client) ListNetwork() (*schema.ListNetworkResponse, error) {
+	return c.ListNetworkWithOpts(ListOpts{})
+}
+
+// List networks, filtered server-side when supported
+func (c *Client) ListNetworkWithOpts(opts ListOpts) (*schema.ListNetworkResponse, error) {
 	var res schema.ListNetworkResponse
 
-	err := c.CallAPI("GET", "37777", "/api/v1.0/client/network/list", nil, &res, true)
+	err := c.CallAPI("GET", "37777", c.listPath("/api/v1.0/client/network/list", opts), nil, &res, true)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,44 @@
+package ecloud
+
+import "fmt"
+
+// A Capability is an optional route of the daemons. The routes below are not
+// served by every daemon version, a call needing one fails with an error with
+// code ErrorUnsupportedError unless it has been enabled with WithCapabilities.
+type Capability string
+
+const (
+	CapabilityVolumeResize Capability = "volume_resize" // POST /api/v1.0/client/volume/resize on the storage daemon
+	CapabilityVolumeClone  Capability = "volume_clone"  // POST /api/v1.0/client/volume/clone on the storage daemon
+	CapabilityVolumeExport Capability = "volume_export" // POST /api/v1.0/client/volume/export on the storage daemon
+	CapabilityVolumeUpload Capability = "volume_upload" // POST /api/v1.0/client/volume/image/upload/ on the storage daemon
+)
+
+// WithCapabilities enables optional routes the daemons are known to serve.
+func WithCapabilities(capabilities ...Capability) ClientOption {
+	return func(client *Client) {
+		if client.capabilities == nil {
+			client.capabilities = make(map[Capability]bool)
+		}
+		for _, capability := range capabilities {
+			client.capabilities[capability] = true
+		}
+	}
+}
+
+// Supports reports whether capability has been enabled on the client.
+func (c *Client) Supports(capability Capability) bool {
+	return c.capabilities[capability]
+}
+
+// requireCapability returns an error with code ErrorUnsupportedError unless
+// capability has been enabled on the client.
+func (c *Client) requireCapability(capability Capability) error {
+	if c.Supports(capability) {
+		return nil
+	}
+	return Error{
+		Code:    ErrorUnsupportedError,
+		Message: fmt.Sprintf("the daemon does not support %s, see WithCapabilities", capability),
+	}
+}
@@ -0,0 +1,33 @@
+package ecloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestCapabilities(t *testing.T) {
+	c, err := NewClient("test", "1.0", WithCapabilities(CapabilityVolumeResize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Supports(CapabilityVolumeResize) {
+		t.Errorf("Supports(%s) = false, want true", CapabilityVolumeResize)
+	}
+	if c.Supports(CapabilityVolumeUpload) {
+		t.Errorf("Supports(%s) = true, want false", CapabilityVolumeUpload)
+	}
+
+	// Without the capability the calls fail before reaching the daemon
+	ctx := context.Background()
+	if _, _, err := c.Volume.Clone(ctx, &Volume{ID: "v1"}, CloneOpts{Name: "copy"}); !IsError(err, ErrorUnsupportedError) {
+		t.Errorf("Clone() = %v, want an unsupported error", err)
+	}
+	if _, _, err := c.Volume.Export(ctx, "v1"); !IsError(err, ErrorUnsupportedError) {
+		t.Errorf("Export() = %v, want an unsupported error", err)
+	}
+	if _, err := c.FeedStorageUpload(schema.FeedStorageUploadRequest{VolumeID: "v1"}, nil); !IsError(err, ErrorUnsupportedError) {
+		t.Errorf("FeedStorageUpload() = %v, want an unsupported error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package ecloud
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// checksum is an expected digest, written "<algorithm>:<hex digest>".
+type checksum struct {
+	algorithm string
+	digest    string
+}
+
+// parseChecksum parses a checksum such as "sha256:9f86d0...". Only sha256 and
+// sha512 are supported.
+func parseChecksum(s string) (checksum, error) {
+	algorithm, digest, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return checksum{}, fmt.Errorf("invalid checksum %q, expected <algorithm>:<digest>", s)
+	}
+	c := checksum{algorithm: strings.ToLower(algorithm), digest: strings.ToLower(digest)}
+
+	h, err := c.newHash()
+	if err != nil {
+		return checksum{}, err
+	}
+	if decoded, err := hex.DecodeString(c.digest); err != nil || len(decoded) != h.Size() {
+		return checksum{}, fmt.Errorf("invalid %s digest %q", c.algorithm, digest)
+	}
+	return c, nil
+}
+
+func (c checksum) newHash() (hash.Hash, error) {
+	switch c.algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", c.algorithm)
+	}
+}
+
+func (c checksum) String() string {
+	return c.algorithm + ":" + c.digest
+}
+
+// verify reads r to the end and returns an error if its digest does not match.
+func (c checksum) verify(r io.Reader) error {
+	h, err := c.newHash()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != c.digest {
+		return Error{
+			Code:    ErrorCodeChecksumMismatch,
+			Message: fmt.Sprintf("expected %s, got %s:%s", c, c.algorithm, actual),
+		}
+	}
+	return nil
+}
+
+// verifyURLChecksum downloads the file at url and verifies its checksum.
+func verifyURLChecksum(ctx context.Context, httpClient *http.Client, url string, expected string) error {
+	c, err := parseChecksum(expected)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	if err := c.verify(resp.Body); err != nil {
+		return fmt.Errorf("image %s: %w", url, err)
+	}
+	return nil
+}
+
+// checkImportedChecksum compares the expected checksum of the image imported
+// into the volume with the one reported by the storage daemon. It returns false
+// if the daemon reported none, or one of another algorithm, which cannot be
+// compared.
+func checkImportedChecksum(volumeID string, expected string, reported string) (bool, error) {
+	want, err := parseChecksum(expected)
+	if err != nil {
+		return false, err
+	}
+	got, err := parseChecksum(reported)
+	if err != nil || got.algorithm != want.algorithm {
+		return false, nil
+	}
+	if got.digest != want.digest {
+		return true, Error{
+			Code:    ErrorCodeChecksumMismatch,
+			Message: fmt.Sprintf("volume %s: expected %s, got %s", volumeID, want, got),
+		}
+	}
+	return true, nil
+}
+
+// downloadClient returns the HTTP client downloading files on behalf of the
+// daemons, without the timeout of the API requests.
+func (c *Client) downloadClient() *http.Client {
+	return &http.Client{Transport: c.httpClient.Transport}
+}
@@ -0,0 +1,123 @@
+package ecloud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Digests of "hello"
+const (
+	helloSHA256 = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloSHA512 = "sha512:9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"
+)
+
+func TestParseChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "SHA-256", value: helloSHA256},
+		{name: "SHA-512", value: helloSHA512},
+		{name: "Upper case", value: strings.ToUpper(helloSHA256)},
+		{name: "Missing algorithm", value: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", wantErr: true},
+		{name: "Unsupported algorithm", value: "md5:5d41402abc4b2a76b9719d911017c592", wantErr: true},
+		{name: "Wrong length", value: "sha512:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", wantErr: true},
+		{name: "Not hex", value: "sha256:" + strings.Repeat("z", 64), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseChecksum(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("parseChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyURLChecksum(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.img" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	if err := verifyURLChecksum(ctx, server.Client(), server.URL+"/image.img", helloSHA256); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := verifyURLChecksum(ctx, server.Client(), server.URL+"/image.img", helloSHA512); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	mismatch := "sha256:" + strings.Repeat("0", 64)
+	if err := verifyURLChecksum(ctx, server.Client(), server.URL+"/image.img", mismatch); !IsError(err, ErrorCodeChecksumMismatch) {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	if err := verifyURLChecksum(ctx, server.Client(), server.URL+"/missing.img", helloSHA256); err == nil {
+		t.Errorf("expected an error for a missing image")
+	}
+}
+
+func TestCheckImportedChecksum(t *testing.T) {
+	tests := []struct {
+		name         string
+		reported     string
+		wantVerified bool
+		wantCode     ErrorCode // Empty if no error is expected
+	}{
+		{name: "Verified", reported: helloSHA256, wantVerified: true},
+		{name: "Verified in upper case", reported: strings.ToUpper(helloSHA256), wantVerified: true},
+		{name: "Mismatch", reported: "sha256:" + strings.Repeat("0", 64), wantVerified: true, wantCode: ErrorCodeChecksumMismatch},
+		{name: "Not reported", reported: ""},
+		{name: "Other algorithm", reported: helloSHA512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := checkImportedChecksum("v1", helloSHA256, tt.reported)
+			if verified != tt.wantVerified {
+				t.Errorf("checkImportedChecksum() verified = %v, want %v", verified, tt.wantVerified)
+			}
+			if tt.wantCode == "" && err != nil {
+				t.Errorf("checkImportedChecksum() unexpected error: %v", err)
+			}
+			if tt.wantCode != "" && !IsError(err, tt.wantCode) {
+				t.Errorf("checkImportedChecksum() error = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestVerifyImport(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	client, _ := NewClient("test", "1")
+	volumeClient := &VolumeClient{client: client}
+	ctx := context.Background()
+	opts := VolumeCreateOpts{Name: "v", Url: server.URL + "/image.img", Checksum: helloSHA256}
+
+	// The checksum reported by the daemon is trusted without downloading the image
+	if err := volumeClient.verifyImport(ctx, "v1", opts, helloSHA256); err != nil || downloads != 0 {
+		t.Errorf("verifyImport() = %v after %d downloads, want no error and no download", err, downloads)
+	}
+
+	// Without it, the client downloads and verifies the image
+	if err := volumeClient.verifyImport(ctx, "v1", opts, ""); err != nil || downloads != 1 {
+		t.Errorf("verifyImport() = %v after %d downloads, want no error and 1 download", err, downloads)
+	}
+	opts.Checksum = "sha256:" + strings.Repeat("0", 64)
+	if err := volumeClient.verifyImport(ctx, "v1", opts, ""); !IsError(err, ErrorCodeChecksumMismatch) {
+		t.Errorf("verifyImport() error = %v, want a checksum mismatch", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -59,15 +60,39 @@ type Client struct {
 	userAgent          string
 	logger             Logger
 
-	Server  ServerClient
-	Network NetworkClient
-	SSHKey  SSHKeyClient
-	Volume  VolumeClient
+	// serverSideLabelSelector sends ListOpts.LabelSelector to the daemons
+	serverSideLabelSelector bool
+
+	// capabilities holds the optional routes enabled with WithCapabilities
+	capabilities map[Capability]bool
+
+	// serverStatuses holds the status of servers (by name) going through a
+	// client-side operation the daemon knows nothing about, e.g. a rebuild
+	mu             sync.Mutex
+	serverStatuses map[string]ServerStatus
+
+	Server         ServerClient
+	Network        NetworkClient
+	SSHKey         SSHKeyClient
+	Volume         VolumeClient
+	PlacementGroup PlacementGroupClient
 
 	// TODO
 }
 
-func NewClient(applicationName string, applicationVersion string) (*Client, error) {
+// A ClientOption is used to configure a [Client].
+type ClientOption func(*Client)
+
+// WithServerSideLabelSelector makes list calls send their label selector to
+// the daemons, for daemons that support filtering by labels. The selector is
+// always evaluated client-side as well.
+func WithServerSideLabelSelector(enabled bool) ClientOption {
+	return func(client *Client) {
+		client.serverSideLabelSelector = enabled
+	}
+}
+
+func NewClient(applicationName string, applicationVersion string, options ...ClientOption) (*Client, error) {
 	if applicationName == "" {
 		return nil, fmt.Errorf("application name cannot be empty")
 	}
@@ -85,8 +110,15 @@ func NewClient(applicationName string, applicationVersion string) (*Client, erro
 		userAgent:          fmt.Sprintf("%s/%s", applicationName, applicationVersion),
 	}
 
+	for _, option := range options {
+		option(client)
+	}
+
 	client.Server = ServerClient{client: client}
 	client.Network = NetworkClient{client: client}
+	client.SSHKey = SSHKeyClient{client: client}
+	client.Volume = VolumeClient{client: client}
+	client.PlacementGroup = PlacementGroupClient{client: client}
 
 	// TODO: research real data needed for the client
 
@@ -164,3 +196,42 @@ func (l ListOpts) Values() url.Values {
 	}
 	return vals
 }
+
+// listPath returns path with the list options appended as query parameters
+// when the daemons support server-side filtering.
+func (c *Client) listPath(path string, opts ListOpts) string {
+	if !c.serverSideLabelSelector {
+		return path
+	}
+	vals := opts.Values()
+	if len(vals) == 0 {
+		return path
+	}
+	return path + "?" + vals.Encode()
+}
+
+// setServerStatus overrides the status reported for the named server until
+// clearServerStatus is called.
+func (c *Client) setServerStatus(name string, status ServerStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.serverStatuses == nil {
+		c.serverStatuses = map[string]ServerStatus{}
+	}
+	c.serverStatuses[name] = status
+}
+
+// clearServerStatus removes the status override of the named server.
+func (c *Client) clearServerStatus(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.serverStatuses, name)
+}
+
+// serverStatus returns the status override of the named server, if any.
+func (c *Client) serverStatus(name string) (ServerStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.serverStatuses[name]
+	return status, ok
+}
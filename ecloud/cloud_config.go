@@ -1,5 +1,7 @@
 package ecloud
 
+import "strings"
+
 // CloudinitTemplate contains the cloud-init user-data configuration
 const CloudinitTemplate = `#cloud-config
 
@@ -10,7 +12,6 @@ users:
     shell: /bin/bash
     lock_passwd: false
     ssh_authorized_keys:
-      - ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAACAQD035mfursjtGxrz+hs1iUA/WtmLI/mz6oF2SlYRpT6ukepG87m9e5YWgu2u7te2EtBkD1ofDURq1f97k/qoBJCHomneSL7lyUKiDtcWwjjBN89To8IPil621UCLX8whGj5me9iI3EDuP5/vRsV7tRzFVxY4lPD1Z7oz1+l0x2dEBqpAESASq3kX/ndpagql5p6lX9gxeB/qXzGY6i/ufJp7JMInkQVA1zVcsbYzTqIM28qC3VJ2mQhWp5CobNlJnruoaHmH+QPWB4DiSHgg0E4eceGZaghol1DHzkkdDMMIgnELUHems2le6vPVjzPFSoRAV5/mRDYNkL7CaiaGPmG6+EMITu/RV1ufCaxJgBYYgABEW2zsVjFjFpt7hhRd1fkd3Cx05ahMCFoCavojOWaswKBJUqoOPX0nyXKZtKpebU5jicrQ/prW7KfLeizwmmTcwMzCVQnc8W86ctNBhT80R2YnXAhPzbtmC6iJgBHkxGJObePCYP2SBwv9NSmlJKuua5ATap2XIOM9FQ1sEP/zdLe+5HuoU4gXUbrWmlbO+IbW6/kqBMOi7OpdZ1JBbsnOcbMbB2mEm99UlotvdLWTR6V/fxvIZ5JYE7ybFmsRV5tAr7YIrQ26q97hXX7HDNOqmtWQERUDImU3t+cetZ8GQGh9KMgqmCxHM/qkyfHfw== paolo.beci@gmail.com
 
 ssh_pwauth: true
 
@@ -61,3 +62,89 @@ runcmd:
 
 // MetaDataTemplate contains the cloud-init meta-data configuration
 const MetaDataTemplate = `instance-id: id-vm-kops`
+
+// legacyDataDiskCommands are the runcmd entries of CloudinitTemplate formatting
+// and mounting the data disk requested by ServerType.Disk.
+const legacyDataDiskCommands = `  - mkdir -p /mnt/disks/test.k8s--main--
+  - mkdir -p /mnt/disks/test.k8s--events--
+  - mkfs.ext4 /dev/vdb
+  - mount /dev/vdb /mnt/disks/test.k8s--main--
+  - mount /dev/vdb /mnt/disks/test.k8s--events--
+  - mkdir -p /mnt/disks/test.k8s--main--/mnt
+  - mkdir -p /mnt/disks/test.k8s--events--/mnt
+  - sudo chown -R root:root /mnt/disks/test.k8s--main--
+  - sudo chmod 755 /mnt/disks/test.k8s--main--
+  - sudo chown -R root:root /mnt/disks/test.k8s--events--
+  - sudo chmod 755 /mnt/disks/test.k8s--events--
+  - blkid /dev/vdb1
+`
+
+// legacyMountCommands are legacyDataDiskCommands without formatting the data
+// disk, mounting a data disk that already holds a filesystem.
+var legacyMountCommands = strings.Replace(legacyDataDiskCommands, "  - mkfs.ext4 /dev/vdb\n", "", 1)
+
+// templateChpasswd is the chpasswd section of CloudinitTemplate.
+const templateChpasswd = `chpasswd:
+  list: |
+    root:password
+  expire: false
+`
+
+// cloudInitConfig holds the values renderCloudInit sets in CloudinitTemplate.
+type cloudInitConfig struct {
+	Hostname     string
+	UserData     string // kOps script embedded in write_files
+	Layout       diskLayout
+	PasswordHash string   // SHA-512 crypt hash of the root password, password login is disabled if empty
+	SSHKeys      []string // Public keys authorized for root
+}
+
+// renderCloudInit renders the user-data of a server from CloudinitTemplate,
+// setting its hostname, root credentials and kOps userData script. With data
+// disks in the layout, the template's disk commands are replaced by the
+// cloud-init disk configuration; kept data disks are never formatted.
+func renderCloudInit(cfg cloudInitConfig) string {
+	content := CloudinitTemplate
+	if cfg.Hostname != "" {
+		content = strings.Replace(content, "hostname: myhost", "hostname: "+cfg.Hostname, 1)
+	}
+
+	// Root credentials: the template password is never kept
+	keys := ""
+	for _, key := range cfg.SSHKeys {
+		keys += "      - " + strings.TrimSpace(key) + "\n"
+	}
+	if keys != "" {
+		content = strings.Replace(content, "    ssh_authorized_keys:\n", "    ssh_authorized_keys:\n"+keys, 1)
+	} else {
+		content = strings.Replace(content, "    ssh_authorized_keys:\n", "", 1)
+	}
+	if cfg.PasswordHash != "" {
+		content = strings.Replace(content, "    root:password\n", "    root:"+cfg.PasswordHash+"\n", 1)
+	} else {
+		content = strings.Replace(content, templateChpasswd, "", 1)
+		content = strings.Replace(content, "ssh_pwauth: true", "ssh_pwauth: false", 1)
+		content = strings.Replace(content, "lock_passwd: false", "lock_passwd: true", 1)
+	}
+
+	// Inject userData into the template by replacing the "data" placeholder
+	if cfg.UserData != "" {
+		content = injectUserDataIntoTemplate(content, cfg.UserData)
+	}
+
+	switch {
+	case cfg.Layout.kept && len(cfg.Layout.data) > 0:
+		// Existing data disks are mounted again, never partitioned or formatted
+		content = strings.Replace(content, legacyDataDiskCommands, "", 1)
+		content += "\n\n" + cloudInitMounts(cfg.Layout.data)
+	case len(cfg.Layout.data) > 0:
+		content = strings.Replace(content, legacyDataDiskCommands, "", 1)
+		content += "\n\n" + cloudInitDiskConfig(cfg.Layout.data)
+	case cfg.Layout.kept && cfg.Layout.legacyDisk > 0:
+		// An existing data disk is mounted again, never formatted
+		content = strings.Replace(content, legacyDataDiskCommands, legacyMountCommands, 1)
+	case cfg.Layout.kept:
+		content = strings.Replace(content, legacyDataDiskCommands, "", 1)
+	}
+	return content
+}
@@ -0,0 +1,52 @@
+package ecloud
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRenderCloudInit(t *testing.T) {
+	content := renderCloudInit(cloudInitConfig{Hostname: "web-1", UserData: "#!/bin/bash\necho hello"})
+
+	if !strings.Contains(content, "hostname: web-1\n") {
+		t.Errorf("expected hostname to be set")
+	}
+	if !strings.Contains(content, "      #!/bin/bash\n      echo hello") {
+		t.Errorf("expected userData to be embedded in write_files")
+	}
+	if strings.Contains(content, "      data\n") {
+		t.Errorf("expected the data placeholder to be replaced")
+	}
+}
+
+func TestRenderCloudInitRootLogin(t *testing.T) {
+	withPassword := renderCloudInit(cloudInitConfig{Hostname: "web-1", PasswordHash: "$6$salt$hash"})
+	if !strings.Contains(withPassword, "    root:$6$salt$hash\n") || !strings.Contains(withPassword, "ssh_pwauth: true") {
+		t.Errorf("expected the root password hash with password login enabled")
+	}
+	if strings.Contains(withPassword, "root:password") {
+		t.Errorf("expected the template password to be replaced")
+	}
+
+	withKeys := renderCloudInit(cloudInitConfig{Hostname: "web-1", SSHKeys: []string{"ssh-ed25519 AAAAC3Nza user@host"}})
+	if !strings.Contains(withKeys, "    ssh_authorized_keys:\n      - ssh-ed25519 AAAAC3Nza user@host\n") {
+		t.Errorf("expected the SSH key to be authorized")
+	}
+	if strings.Contains(withPassword, "ssh_authorized_keys:") {
+		t.Errorf("expected no authorized keys without SSH keys")
+	}
+	if strings.Contains(withKeys, "chpasswd:") || !strings.Contains(withKeys, "ssh_pwauth: false") || !strings.Contains(withKeys, "lock_passwd: true") {
+		t.Errorf("expected password login to be disabled")
+	}
+}
+
+func TestCreateCloudInitRequiresCredentials(t *testing.T) {
+	client, _ := NewClient("test", "1")
+	volumeClient := &VolumeClient{client: client}
+
+	_, _, err := volumeClient.CreateCloudInit(context.Background(), CloudInitCreateOpts{Name: "web-1"}, "")
+	if !IsError(err, ErrorCodeInvalidInput) {
+		t.Errorf("CreateCloudInit() error = %v, want %s", err, ErrorCodeInvalidInput)
+	}
+}
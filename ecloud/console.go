@@ -0,0 +1,306 @@
+package ecloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConsoleProtocol specifies the remote display protocol of a server console.
+type ConsoleProtocol string
+
+const (
+	// ConsoleProtocolVNC is the VNC remote framebuffer protocol.
+	ConsoleProtocolVNC ConsoleProtocol = "vnc"
+
+	// ConsoleProtocolSPICE is the SPICE remote display protocol.
+	ConsoleProtocolSPICE ConsoleProtocol = "spice"
+)
+
+// ServerConsole describes how to reach the remote console of a server.
+type ServerConsole struct {
+	Protocol ConsoleProtocol
+	Host     string // Hypervisor host serving the console
+	Port     int
+	Password SecretString // Empty if the console has no password, use Reveal to read it
+}
+
+// Address returns the host:port address of the console.
+func (c *ServerConsole) Address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// Console returns the remote console of a server, as reported by its display device.
+func (c *ServerClient) Console(ctx context.Context, id string) (*ServerConsole, *Response, error) {
+	body, err := c.client.GetCompute()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, s := range *body {
+		if s.UniqueID != id {
+			continue
+		}
+		display := s.NetworkConfig.DomDisplay
+
+		protocol := ConsoleProtocol(strings.ToLower(strings.TrimSpace(display.Protocol)))
+		if protocol != ConsoleProtocolVNC && protocol != ConsoleProtocolSPICE {
+			return nil, nil, Error{
+				Code:    ErrorUnsupportedError,
+				Message: fmt.Sprintf("unsupported console protocol %q for server %s", display.Protocol, id),
+			}
+		}
+		if display.Port <= 0 {
+			return nil, nil, Error{
+				Code:    ErrorCodeResourceUnavailable,
+				Message: fmt.Sprintf("console of server %s is not available", id),
+			}
+		}
+		u, err := url.Parse(s.ServerURL)
+		if err != nil || u.Hostname() == "" {
+			return nil, nil, fmt.Errorf("unknown host for server %s: %q", id, s.ServerURL)
+		}
+
+		return &ServerConsole{
+			Protocol: protocol,
+			Host:     u.Hostname(),
+			Port:     display.Port,
+			Password: SecretString(display.Password),
+		}, &Response{}, nil
+	}
+
+	return nil, nil, Error{Code: ErrorCodeNotFound, Message: "server not found"}
+}
+
+// ConsoleProxyOpts specifies options for proxying a server console.
+type ConsoleProxyOpts struct {
+	ListenAddr string // Local address to listen on, "127.0.0.1:0" if not set
+	WebSocket  bool   // Serve the console over WebSocket (e.g. for noVNC) instead of raw TCP
+}
+
+// ConsoleProxy forwards connections from a local listener to a server console.
+type ConsoleProxy struct {
+	console  *ServerConsole
+	listener net.Listener
+	server   *http.Server // Serves the WebSocket connections, nil for raw TCP
+	dialer   net.Dialer
+
+	mu        sync.Mutex
+	conns     map[io.Closer]struct{} // Open connections, closed by Close
+	closed    bool
+	closeOnce sync.Once
+}
+
+// ProxyConsole starts a proxy that forwards local connections to the console,
+// so it can be opened without knowing the hypervisor host. The proxy stops
+// when ctx is done or Close is called.
+func ProxyConsole(ctx context.Context, console *ServerConsole, opts ConsoleProxyOpts) (*ConsoleProxy, error) {
+	if console == nil {
+		return nil, errors.New("missing console")
+	}
+	listenAddr := opts.ListenAddr
+	if listenAddr == "" {
+		listenAddr = "127.0.0.1:0"
+	}
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+
+	p := &ConsoleProxy{
+		console:  console,
+		listener: listener,
+		conns:    map[io.Closer]struct{}{},
+	}
+
+	go func() {
+		<-ctx.Done()
+		p.Close()
+	}()
+	if opts.WebSocket {
+		p.server = &http.Server{Handler: http.HandlerFunc(p.serveWebSocket)}
+		go p.server.Serve(listener)
+	} else {
+		go p.serveTCP(ctx)
+	}
+	return p, nil
+}
+
+// Addr returns the local address the proxy listens on.
+func (p *ConsoleProxy) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// URL returns the URL a console client should connect to.
+func (p *ConsoleProxy) URL() string {
+	if p.server != nil {
+		return "ws://" + p.listener.Addr().String() + "/"
+	}
+	return string(p.console.Protocol) + "://" + p.listener.Addr().String()
+}
+
+// Close stops accepting new connections and closes the open ones.
+func (p *ConsoleProxy) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		err = p.listener.Close()
+		if p.server != nil {
+			// Upgraded connections are hijacked, the server does not close them
+			p.server.Close()
+		}
+
+		p.mu.Lock()
+		conns := p.conns
+		p.conns, p.closed = nil, true
+		p.mu.Unlock()
+		for conn := range conns {
+			conn.Close()
+		}
+	})
+	return err
+}
+
+// track records open connections, so that Close closes them. It returns false,
+// recording nothing, if the proxy is closed.
+func (p *ConsoleProxy) track(conns ...io.Closer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	for _, conn := range conns {
+		p.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+// untrack forgets connections closed by their handler.
+func (p *ConsoleProxy) untrack(conns ...io.Closer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		delete(p.conns, conn)
+	}
+}
+
+func (p *ConsoleProxy) serveTCP(ctx context.Context) {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			upstream, err := p.dialer.DialContext(ctx, "tcp", p.console.Address())
+			if err != nil {
+				return
+			}
+			defer upstream.Close()
+			if !p.track(conn, upstream) {
+				return
+			}
+			defer p.untrack(conn, upstream)
+			pipe(conn, upstream)
+		}()
+	}
+}
+
+// pipe copies data in both directions until one side is closed.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// ------------------------------ WEBSOCKET -----------------------------------
+
+// webSocketUpgrader upgrades the console connections. noVNC asks for the
+// "binary" subprotocol; cross-origin requests are rejected.
+var webSocketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	Subprotocols:    []string{"binary"},
+}
+
+func (p *ConsoleProxy) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", p.console.Address())
+	if err != nil {
+		http.Error(w, "console unavailable", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	// Upgrade replies to the client itself on failure
+	ws, err := webSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	if !p.track(ws, upstream) {
+		return
+	}
+	defer p.untrack(ws, upstream)
+
+	done := make(chan struct{}, 2)
+
+	// Console -> browser
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := upstream.Read(buf)
+			if n > 0 {
+				if werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					break
+				}
+			}
+			if err != nil {
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				break
+			}
+		}
+		done <- struct{}{}
+	}()
+
+	// Browser -> console
+	go func() {
+		forwardMessages(ws, upstream)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// forwardMessages writes the messages received on ws to upstream until the
+// WebSocket is closed. Pings and close frames are answered by ws.
+func forwardMessages(ws *websocket.Conn, upstream net.Conn) {
+	for {
+		_, r, err := ws.NextReader()
+		if err != nil {
+			return
+		}
+		if _, err := io.Copy(upstream, r); err != nil {
+			return
+		}
+	}
+}
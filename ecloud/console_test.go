@@ -0,0 +1,208 @@
+package ecloud
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startEchoServer starts a TCP server echoing back everything it receives.
+func startEchoServer(t *testing.T) *ServerConsole {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start echo server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return &ServerConsole{Protocol: ConsoleProtocolVNC, Host: addr.IP.String(), Port: addr.Port}
+}
+
+func TestProxyConsoleTCP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	console := startEchoServer(t)
+	proxy, err := ProxyConsole(ctx, console, ConsoleProxyOpts{})
+	if err != nil {
+		t.Fatalf("ProxyConsole returned error: %v", err)
+	}
+	defer proxy.Close()
+
+	conn, err := net.DialTimeout("tcp", proxy.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("RFB 003.008\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buf := make([]byte, 12)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(buf) != "RFB 003.008\n" {
+		t.Errorf("unexpected echo: %q", buf)
+	}
+}
+
+func TestProxyConsoleWebSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	console := startEchoServer(t)
+	proxy, err := ProxyConsole(ctx, console, ConsoleProxyOpts{WebSocket: true})
+	if err != nil {
+		t.Fatalf("ProxyConsole returned error: %v", err)
+	}
+	defer proxy.Close()
+
+	dialer := websocket.Dialer{HandshakeTimeout: time.Second, Subprotocols: []string{"binary"}}
+	ws, _, err := dialer.Dial(proxy.URL(), nil)
+	if err != nil {
+		t.Fatalf("failed to connect to proxy: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if ws.Subprotocol() != "binary" {
+		t.Errorf("unexpected subprotocol %q", ws.Subprotocol())
+	}
+
+	payload := []byte("RFB 003.008\n")
+	if err := ws.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	messageType, echoed, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	if messageType != websocket.BinaryMessage || string(echoed) != string(payload) {
+		t.Errorf("unexpected message: type %d payload %q", messageType, echoed)
+	}
+}
+
+func TestProxyConsoleWebSocketRejectsPlainHTTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy, err := ProxyConsole(ctx, startEchoServer(t), ConsoleProxyOpts{WebSocket: true})
+	if err != nil {
+		t.Fatalf("ProxyConsole returned error: %v", err)
+	}
+	defer proxy.Close()
+
+	resp, err := http.Get("http://" + proxy.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestProxyConsoleCloseClosesOpenConnections(t *testing.T) {
+	tests := []struct {
+		name      string
+		webSocket bool
+	}{
+		{"tcp", false},
+		{"websocket", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := ProxyConsole(context.Background(), startEchoServer(t), ConsoleProxyOpts{WebSocket: tt.webSocket})
+			if err != nil {
+				t.Fatalf("ProxyConsole returned error: %v", err)
+			}
+
+			// read waits for the next data received from the proxy
+			var read func() error
+			if tt.webSocket {
+				ws, _, err := websocket.DefaultDialer.Dial(proxy.URL(), nil)
+				if err != nil {
+					t.Fatalf("failed to connect to proxy: %v", err)
+				}
+				defer ws.Close()
+				ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if err := ws.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+				read = func() error {
+					_, _, err := ws.ReadMessage()
+					return err
+				}
+			} else {
+				conn, err := net.DialTimeout("tcp", proxy.Addr().String(), time.Second)
+				if err != nil {
+					t.Fatalf("failed to connect to proxy: %v", err)
+				}
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+				buf := make([]byte, 4)
+				read = func() error {
+					_, err := io.ReadFull(conn, buf)
+					return err
+				}
+			}
+
+			// The echo proves the connection is proxied before closing
+			if err := read(); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if err := proxy.Close(); err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+			err = read()
+			if err == nil {
+				t.Fatal("expected the connection to be closed")
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				t.Fatalf("connection still open after Close: %v", err)
+			}
+		})
+	}
+}
+
+func TestServerConsolePasswordRedacted(t *testing.T) {
+	console := &ServerConsole{Protocol: ConsoleProtocolVNC, Host: "10.0.0.1", Port: 5900, Password: "s3cret"}
+	if printed := fmt.Sprintf("%+v", console); strings.Contains(printed, "s3cret") {
+		t.Errorf("password leaked in %s", printed)
+	}
+	if console.Password.Reveal() != "s3cret" {
+		t.Errorf("Reveal() = %q", console.Password.Reveal())
+	}
+}
+
+func TestServerConsoleAddress(t *testing.T) {
+	console := &ServerConsole{Host: "51.159.157.254", Port: 5900}
+	if got := console.Address(); got != "51.159.157.254:5900" {
+		t.Errorf("Address() = %q", got)
+	}
+}
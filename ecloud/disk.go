@@ -0,0 +1,236 @@
+package ecloud
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// DiskBus specifies the bus a disk is attached to.
+type DiskBus string
+
+const (
+	// DiskBusVirtio attaches the disk as a paravirtualized device (/dev/vd*).
+	DiskBusVirtio DiskBus = "virtio"
+
+	// DiskBusSCSI attaches the disk to an emulated SCSI controller (/dev/sd*).
+	DiskBusSCSI DiskBus = "scsi"
+
+	// DiskBusSATA attaches the disk to an emulated SATA controller (/dev/sd*).
+	DiskBusSATA DiskBus = "sata"
+)
+
+// defaultBootDiskSize is the size in GB of the boot disk if not set.
+const defaultBootDiskSize = 50
+
+// BootDiskSpec specifies the boot disk of a server.
+type BootDiskSpec struct {
+	Size   int     // Size in GB, 50 if not set
+	Bus    DiskBus // virtio if not set
+	Shared bool    // Visible to the other users of the storage, private if not set
+}
+
+// DiskSpec specifies a data disk of a server, formatted and mounted by cloud-init.
+type DiskSpec struct {
+	Size       int    // Size in GB
+	Filesystem string // ext4 (default), xfs or btrfs
+	MountPoint string // Absolute path the disk is mounted at, not mounted if not set
+	Label      string // Filesystem label
+}
+
+// maxLabelLength is the longest filesystem label supported by each filesystem.
+var maxLabelLength = map[string]int{
+	"ext4":  16,
+	"xfs":   12,
+	"btrfs": 255,
+}
+
+// Validate checks if the boot disk spec is valid.
+func (s BootDiskSpec) Validate() error {
+	if s.Size < 0 {
+		return errors.New("boot disk size must not be negative")
+	}
+	switch s.Bus {
+	case "", DiskBusVirtio, DiskBusSCSI, DiskBusSATA:
+		return nil
+	default:
+		return fmt.Errorf("unsupported boot disk bus %q", s.Bus)
+	}
+}
+
+// Validate checks if the data disk spec is valid.
+func (s DiskSpec) Validate() error {
+	if s.Size <= 0 {
+		return errors.New("data disk size must be greater than 0")
+	}
+	maxLength, ok := maxLabelLength[s.filesystem()]
+	if !ok {
+		return fmt.Errorf("unsupported filesystem %q", s.Filesystem)
+	}
+	if len(s.Label) > maxLength {
+		return fmt.Errorf("label %q is longer than %d characters", s.Label, maxLength)
+	}
+	if strings.ContainsAny(s.Label, " \t\n\"'") {
+		return fmt.Errorf("invalid label %q", s.Label)
+	}
+	if s.MountPoint != "" && (!path.IsAbs(s.MountPoint) || strings.ContainsAny(s.MountPoint, " \t\n\"'")) {
+		return fmt.Errorf("mount point %q must be an absolute path", s.MountPoint)
+	}
+	return nil
+}
+
+func (s DiskSpec) filesystem() string {
+	if s.Filesystem == "" {
+		return "ext4"
+	}
+	return s.Filesystem
+}
+
+// attachedDisk is a data disk with the device name it gets in the VM.
+type attachedDisk struct {
+	DiskSpec
+	Device string // e.g. "/dev/vdb"
+}
+
+// diskLayout is the disk layout of a server, in attach order.
+type diskLayout struct {
+	boot BootDiskSpec
+	data []attachedDisk
+
+	// legacyDisk is the size of the data disk requested by ServerType.Disk,
+	// formatted and mounted by the commands of CloudinitTemplate
+	legacyDisk int
+
+	// kept is set when the data volumes already exist, e.g. when a server is
+	// rebuilt: they are never formatted, the legacy data disk is only mounted
+	kept bool
+}
+
+// diskLayout returns the disk layout requested by opts. Data disks are
+// attached after the boot disk, the cloud-init volume being a CD-ROM.
+func (o ServerCreateOpts) diskLayout() diskLayout {
+	layout := diskLayout{}
+	if o.BootDisk != nil {
+		layout.boot = *o.BootDisk
+	}
+	if layout.boot.Size == 0 {
+		layout.boot.Size = defaultBootDiskSize
+	}
+	if layout.boot.Bus == "" {
+		layout.boot.Bus = DiskBusVirtio
+	}
+
+	if len(o.DataDisks) == 0 {
+		if o.ServerType != nil {
+			layout.legacyDisk = o.ServerType.Disk
+		}
+		return layout
+	}
+
+	// Data disks are virtio devices, following the boot disk if it is one too
+	index := 0
+	if layout.boot.Bus == DiskBusVirtio {
+		index = 1
+	}
+	for i, disk := range o.DataDisks {
+		layout.data = append(layout.data, attachedDisk{
+			DiskSpec: disk,
+			Device:   "/dev/" + deviceName(DiskBusVirtio, index+i),
+		})
+	}
+	return layout
+}
+
+// rebuildLayout returns the disk layout of the server name, described by s,
+// once rebuilt: the boot disk keeps its size and bus, the data volumes are kept
+// and the data disks stored in its LabelDataDisks label are mounted again.
+func rebuildLayout(name string, s schema.Server) diskLayout {
+	layout := diskLayout{boot: BootDiskSpec{Size: defaultBootDiskSize, Bus: DiskBusVirtio}, kept: true}
+	layout.data = labelledDataDisks(s.Labels)
+	for _, vol := range serverVolumes(s) {
+		switch vol.Name {
+		case name + "-boot":
+			if vol.Size > 0 {
+				layout.boot.Size = int(math.Ceil(vol.Size))
+			}
+			if vol.Bus != "" {
+				layout.boot.Bus = DiskBus(vol.Bus)
+			}
+			layout.boot.Shared = !vol.Private
+		case name:
+			layout.legacyDisk = int(math.Ceil(vol.Size))
+		}
+	}
+	return layout
+}
+
+// dataVolumes returns the options of the data volumes of the server.
+func (l diskLayout) dataVolumes(serverName string, idempotencyKey string) []VolumeCreateOpts {
+	if l.legacyDisk > 0 {
+		return []VolumeCreateOpts{dataVolumeOpts(serverName, l.legacyDisk, idempotencyKey)}
+	}
+	volumes := make([]VolumeCreateOpts, len(l.data))
+	for i, disk := range l.data {
+		volumes[i] = dataVolumeOpts(fmt.Sprintf("%s-data-%d", serverName, i), disk.Size, idempotencyKey)
+	}
+	return volumes
+}
+
+// deviceName returns the name of the index-th disk (starting at 0) on bus,
+// e.g. "vdb" for the second virtio disk.
+func deviceName(bus DiskBus, index int) string {
+	prefix := "vd"
+	if bus == DiskBusSCSI || bus == DiskBusSATA {
+		prefix = "sd"
+	}
+	name := ""
+	for index >= 0 {
+		name = string(rune('a'+index%26)) + name
+		index = index/26 - 1
+	}
+	return prefix + name
+}
+
+// cloudInitDiskConfig returns the cloud-init disk_setup, fs_setup and mounts
+// sections partitioning, formatting and mounting disks.
+func cloudInitDiskConfig(disks []attachedDisk) string {
+	if len(disks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("disk_setup:\n")
+	for _, disk := range disks {
+		fmt.Fprintf(&b, "  %s:\n    table_type: gpt\n    layout: true\n    overwrite: false\n", disk.Device)
+	}
+
+	b.WriteString("fs_setup:\n")
+	for _, disk := range disks {
+		fmt.Fprintf(&b, "  - device: %s\n    partition: auto\n    filesystem: %s\n", disk.Device, disk.filesystem())
+		if disk.Label != "" {
+			fmt.Fprintf(&b, "    label: %s\n", disk.Label)
+		}
+	}
+
+	b.WriteString(cloudInitMounts(disks))
+	return b.String()
+}
+
+// cloudInitMounts returns the cloud-init mounts section mounting the disks
+// with a mount point, empty if there is none.
+func cloudInitMounts(disks []attachedDisk) string {
+	mounts := ""
+	for _, disk := range disks {
+		if disk.MountPoint != "" {
+			mounts += fmt.Sprintf("  - [ %s1, %s, %s, \"defaults,nofail\", \"0\", \"2\" ]\n", disk.Device, disk.MountPoint, disk.filesystem())
+		}
+	}
+	if mounts == "" {
+		return ""
+	}
+	return "mounts:\n" + mounts
+}
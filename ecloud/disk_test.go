@@ -0,0 +1,219 @@
+package ecloud
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestDeviceName(t *testing.T) {
+	tests := []struct {
+		bus      DiskBus
+		index    int
+		expected string
+	}{
+		{DiskBusVirtio, 0, "vda"},
+		{DiskBusVirtio, 1, "vdb"},
+		{DiskBusSCSI, 2, "sdc"},
+		{DiskBusSATA, 25, "sdz"},
+		{DiskBusVirtio, 26, "vdaa"},
+	}
+
+	for _, tt := range tests {
+		if got := deviceName(tt.bus, tt.index); got != tt.expected {
+			t.Errorf("deviceName(%s, %d) = %s, want %s", tt.bus, tt.index, got, tt.expected)
+		}
+	}
+}
+
+func TestDiskLayout(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            ServerCreateOpts
+		expectedBoot    BootDiskSpec
+		expectedDevices []string
+		expectedVolumes []string
+	}{
+		{
+			name:         "Default boot disk without data disk",
+			opts:         ServerCreateOpts{ServerType: &ServerType{Name: "neon"}},
+			expectedBoot: BootDiskSpec{Size: 50, Bus: DiskBusVirtio},
+		},
+		{
+			name:            "Legacy data disk",
+			opts:            ServerCreateOpts{ServerType: &ServerType{Name: "neon", Disk: 20}},
+			expectedBoot:    BootDiskSpec{Size: 50, Bus: DiskBusVirtio},
+			expectedVolumes: []string{"web-1"},
+		},
+		{
+			name: "Data disks after a virtio boot disk",
+			opts: ServerCreateOpts{
+				ServerType: &ServerType{Name: "neon", Disk: 20},
+				BootDisk:   &BootDiskSpec{Size: 30},
+				DataDisks:  []DiskSpec{{Size: 10}, {Size: 20}},
+			},
+			expectedBoot:    BootDiskSpec{Size: 30, Bus: DiskBusVirtio},
+			expectedDevices: []string{"/dev/vdb", "/dev/vdc"},
+			expectedVolumes: []string{"web-1-data-0", "web-1-data-1"},
+		},
+		{
+			name: "Data disks after a SCSI boot disk",
+			opts: ServerCreateOpts{
+				BootDisk:  &BootDiskSpec{Bus: DiskBusSCSI},
+				DataDisks: []DiskSpec{{Size: 10}},
+			},
+			expectedBoot:    BootDiskSpec{Size: 50, Bus: DiskBusSCSI},
+			expectedDevices: []string{"/dev/vda"},
+			expectedVolumes: []string{"web-1-data-0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := tt.opts.diskLayout()
+			if layout.boot != tt.expectedBoot {
+				t.Errorf("boot = %+v, want %+v", layout.boot, tt.expectedBoot)
+			}
+			if len(layout.data) != len(tt.expectedDevices) {
+				t.Fatalf("got %d data disks, want %d", len(layout.data), len(tt.expectedDevices))
+			}
+			for i, disk := range layout.data {
+				if disk.Device != tt.expectedDevices[i] {
+					t.Errorf("data disk %d device = %s, want %s", i, disk.Device, tt.expectedDevices[i])
+				}
+			}
+			volumes := layout.dataVolumes("web-1", "")
+			if len(volumes) != len(tt.expectedVolumes) {
+				t.Fatalf("got %d data volumes, want %d", len(volumes), len(tt.expectedVolumes))
+			}
+			for i, volume := range volumes {
+				if volume.Name != tt.expectedVolumes[i] || volume.Bootable {
+					t.Errorf("data volume %d = %s (bootable %v), want non-bootable %s", i, volume.Name, volume.Bootable, tt.expectedVolumes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRebuildLayout(t *testing.T) {
+	s := schema.Server{
+		Name: "web-1",
+		Volumes: []schema.StorageVolume{
+			{VolumeID: "boot-volume-id", Name: "web-1-boot", Size: 29.5, Bus: "scsi", Private: true},
+			{VolumeID: "cloudinit-volume-id", Name: "web-1-cloudinit", Cloudinit: true},
+			{VolumeID: "data-volume-id", Name: "web-1", Size: 20},
+		},
+	}
+
+	layout := rebuildLayout("web-1", s)
+	if layout.boot != (BootDiskSpec{Size: 30, Bus: DiskBusSCSI}) {
+		t.Errorf("boot = %+v, want the size, bus and visibility of the current boot volume", layout.boot)
+	}
+	if !layout.kept || layout.legacyDisk != 20 || len(layout.data) != 0 {
+		t.Errorf("unexpected data layout: %+v", layout)
+	}
+
+	disks := ServerCreateOpts{DataDisks: []DiskSpec{
+		{Size: 20, MountPoint: "/srv/data"},
+		{Size: 10, Filesystem: "xfs"},
+		{Size: 5, Filesystem: "xfs", MountPoint: "/srv/logs"},
+	}}.diskLayout()
+	s = schema.Server{
+		Name: "web-3",
+		Volumes: []schema.StorageVolume{
+			{VolumeID: "boot-volume-id", Name: "web-3-boot", Size: 50},
+			{VolumeID: "data-0", Name: "web-3-data-0", Size: 20},
+			{VolumeID: "data-1", Name: "web-3-data-1", Size: 10},
+			{VolumeID: "data-2", Name: "web-3-data-2", Size: 5},
+		},
+		Labels: dataDiskLabels(disks.data),
+	}
+	mounted := rebuildLayout("web-3", s)
+	want := []attachedDisk{
+		{DiskSpec: DiskSpec{Filesystem: "ext4", MountPoint: "/srv/data"}, Device: "/dev/vdb"},
+		{DiskSpec: DiskSpec{Filesystem: "xfs", MountPoint: "/srv/logs"}, Device: "/dev/vdd"},
+	}
+	if !reflect.DeepEqual(mounted.data, want) || mounted.legacyDisk != 0 {
+		t.Errorf("data = %+v, want the mounted data disks %+v", mounted.data, want)
+	}
+
+	empty := rebuildLayout("web-2", schema.Server{Name: "web-2"})
+	if empty.boot != (BootDiskSpec{Size: 50, Bus: DiskBusVirtio}) || empty.legacyDisk != 0 {
+		t.Errorf("unexpected default layout: %+v", empty)
+	}
+}
+
+func TestDiskSpecValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    DiskSpec
+		wantErr bool
+	}{
+		{name: "Valid", spec: DiskSpec{Size: 20, Filesystem: "xfs", MountPoint: "/mnt/etcd", Label: "etcd-main"}},
+		{name: "Missing size", spec: DiskSpec{MountPoint: "/mnt/etcd"}, wantErr: true},
+		{name: "Unsupported filesystem", spec: DiskSpec{Size: 20, Filesystem: "ntfs"}, wantErr: true},
+		{name: "Label too long", spec: DiskSpec{Size: 20, Filesystem: "xfs", Label: "etcd-main-events"}, wantErr: true},
+		{name: "Relative mount point", spec: DiskSpec{Size: 20, MountPoint: "mnt/etcd"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderCloudInitDiskLayout(t *testing.T) {
+	if !strings.Contains(CloudinitTemplate, legacyDataDiskCommands) {
+		t.Fatal("legacyDataDiskCommands must match CloudinitTemplate")
+	}
+
+	legacy := renderCloudInit(cloudInitConfig{Hostname: "web-1", Layout: ServerCreateOpts{ServerType: &ServerType{Disk: 20}}.diskLayout()})
+	if !strings.Contains(legacy, "mkfs.ext4 /dev/vdb") || strings.Contains(legacy, "disk_setup:") {
+		t.Errorf("expected the template disk commands to be kept for the legacy data disk")
+	}
+
+	kept := renderCloudInit(cloudInitConfig{Hostname: "web-1", Layout: diskLayout{kept: true, legacyDisk: 20}})
+	if strings.Contains(kept, "mkfs") || !strings.Contains(kept, "mount /dev/vdb /mnt/disks/test.k8s--main--") {
+		t.Errorf("expected the kept legacy data disk to be mounted without formatting it")
+	}
+	keptData := renderCloudInit(cloudInitConfig{Hostname: "web-1", Layout: diskLayout{kept: true}})
+	if strings.Contains(keptData, "mkfs") || strings.Contains(keptData, "/dev/vdb") {
+		t.Errorf("expected no disk commands for kept data disks")
+	}
+	keptMounts := renderCloudInit(cloudInitConfig{Hostname: "web-1", Layout: diskLayout{kept: true, data: []attachedDisk{
+		{DiskSpec: DiskSpec{Filesystem: "xfs", MountPoint: "/srv/data"}, Device: "/dev/vdb"},
+	}}})
+	if strings.Contains(keptMounts, "mkfs") || strings.Contains(keptMounts, "disk_setup:") || strings.Contains(keptMounts, "fs_setup:") ||
+		!strings.Contains(keptMounts, "mounts:\n  - [ /dev/vdb1, /srv/data, xfs,") {
+		t.Errorf("expected the kept data disks to be mounted without formatting them:\n%s", keptMounts)
+	}
+
+	layout := ServerCreateOpts{DataDisks: []DiskSpec{
+		{Size: 20, MountPoint: "/mnt/disks/main", Label: "etcd-main"},
+		{Size: 10, Filesystem: "xfs"},
+	}}.diskLayout()
+	content := renderCloudInit(cloudInitConfig{Hostname: "web-1", Layout: layout})
+
+	if strings.Contains(content, "mkfs.ext4 /dev/vdb") {
+		t.Errorf("expected the template disk commands to be removed")
+	}
+	for _, expected := range []string{
+		"disk_setup:\n  /dev/vdb:\n    table_type: gpt\n",
+		"  /dev/vdc:\n",
+		"fs_setup:\n  - device: /dev/vdb\n    partition: auto\n    filesystem: ext4\n    label: etcd-main\n",
+		"  - device: /dev/vdc\n    partition: auto\n    filesystem: xfs\n",
+		"mounts:\n  - [ /dev/vdb1, /mnt/disks/main, ext4, \"defaults,nofail\", \"0\", \"2\" ]\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected cloud-init to contain %q", expected)
+		}
+	}
+	if strings.Contains(content, "/dev/vdc1") {
+		t.Errorf("expected the disk without mount point not to be mounted")
+	}
+}
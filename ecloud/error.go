@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"slices"
+	"strings"
 )
 
 // ErrorCode represents an error code returned from the API.
@@ -58,6 +60,7 @@ const (
 	// Volume related error codes.
 	ErrorCodeNoSpaceLeftInLocation ErrorCode = "no_space_left_in_location" // There is no volume space left in the given location
 	ErrorCodeVolumeAlreadyAttached ErrorCode = "volume_already_attached"   // Volume is already attached to a server, detach first
+	ErrorCodeChecksumMismatch      ErrorCode = "checksum_mismatch"         // The imported image does not match its expected checksum
 
 	// Firewall related error codes.
 	ErrorCodeFirewallAlreadyApplied   ErrorCode = "firewall_already_applied"    // Firewall was already applied on resource
@@ -126,6 +129,17 @@ func IsError(err error, code ...ErrorCode) bool {
 	return ok && slices.Index(code, apiErr.Code) > -1
 }
 
+// notFoundError returns err as an ErrorCodeNotFound error with message if it
+// is an *APIError with status 404, so that IsError matches it. Other errors
+// are returned unchanged.
+func notFoundError(err error, message string) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return Error{Code: ErrorCodeNotFound, Message: message, Details: apiErr}
+	}
+	return err
+}
+
 type InvalidIPError struct {
 	IP string
 }
@@ -140,4 +154,28 @@ type DNSNotFoundError struct {
 
 func (e DNSNotFoundError) Error() string {
 	return fmt.Sprintf("dns for ip %s not found", e.IP.String())
-}
\ No newline at end of file
+}
+
+// RollbackError is returned when a multi-step operation failed and the
+// resources it had already created were deleted again. Err is the original
+// failure, CleanupErrors holds the deletions that did not succeed.
+type RollbackError struct {
+	Err           error
+	CleanupErrors []error
+}
+
+func (e *RollbackError) Error() string {
+	if len(e.CleanupErrors) == 0 {
+		return fmt.Sprintf("%v (created resources rolled back)", e.Err)
+	}
+	msgs := make([]string, len(e.CleanupErrors))
+	for i, err := range e.CleanupErrors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%v (rollback failed: %s)", e.Err, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the original failure followed by the cleanup failures.
+func (e *RollbackError) Unwrap() []error {
+	return append([]error{e.Err}, e.CleanupErrors...)
+}
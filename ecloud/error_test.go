@@ -0,0 +1,32 @@
+package ecloud
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNotFoundError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		notFound bool
+	}{
+		{name: "Status 404", err: &APIError{StatusCode: 404, Message: "no such volume"}, notFound: true},
+		{name: "Wrapped status 404", err: fmt.Errorf("lookup failed: %w", &APIError{StatusCode: 404}), notFound: true},
+		{name: "Other status", err: &APIError{StatusCode: 500, Message: "internal error"}},
+		{name: "Other error", err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := notFoundError(tt.err, "volume v1 not found")
+			if got := IsError(err, ErrorCodeNotFound); got != tt.notFound {
+				t.Errorf("IsError(notFoundError(%v), ErrorCodeNotFound) = %v, want %v", tt.err, got, tt.notFound)
+			}
+			if !tt.notFound && err != tt.err {
+				t.Errorf("expected the error to be returned unchanged, got %v", err)
+			}
+		})
+	}
+}
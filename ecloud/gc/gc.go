@@ -0,0 +1,371 @@
+// Package gc collects the volumes and networks left behind by failed server
+// creations and test runs.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud"
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// DefaultGracePeriod is the grace period if not set.
+const DefaultGracePeriod = time.Hour
+
+// volumeNamePattern matches the suffix ServerClient.Create appends to the name
+// of the server in the names of the volumes it creates.
+var volumeNamePattern = regexp.MustCompile(`-(boot|cloudinit|data-[0-9]+)$`)
+
+// Kind specifies the kind of an orphaned resource.
+type Kind string
+
+const (
+	// KindVolume is the kind of storage volumes.
+	KindVolume Kind = "volume"
+
+	// KindNetwork is the kind of networks.
+	KindNetwork Kind = "network"
+)
+
+// Action specifies what the collector did with an orphaned resource.
+type Action string
+
+const (
+	// ActionDeleted is the action when the resource was deleted.
+	ActionDeleted Action = "deleted"
+
+	// ActionReported is the action when the resource would have been deleted
+	// but the collector only reports.
+	ActionReported Action = "reported"
+
+	// ActionPending is the action when the resource is still in its grace period.
+	ActionPending Action = "pending"
+
+	// ActionFailed is the action when the deletion of the resource failed.
+	ActionFailed Action = "failed"
+
+	// ActionInUse is the action when the resource was found in use again
+	// right before its deletion, e.g. by a server being registered again.
+	ActionInUse Action = "in-use"
+)
+
+// Options specifies options of a collector.
+type Options struct {
+	// GracePeriod is how long a resource must be orphaned before it is
+	// deleted, DefaultGracePeriod if not set. The age of a resource is how
+	// long the collector has seen it orphaned, from the first run that found
+	// it so: a collector deletes nothing on its first run, run it again more
+	// often than the grace period. Registering a server again (Attach, Detach,
+	// Rebuild, ChangeType) leaves its volumes unattached for a short time, the
+	// runs in between reset their age.
+	GracePeriod time.Duration
+
+	// LabelSelector restricts the collected resources to the ones matching it.
+	LabelSelector string
+
+	// Networks enables the collection of networks not used by any server.
+	// Networks follow no naming convention, so LabelSelector must be set.
+	Networks bool
+
+	// ReportOnly reports the orphaned resources without deleting them.
+	ReportOnly bool
+}
+
+// Validate checks if options are valid.
+func (o Options) Validate() error {
+	if o.GracePeriod < 0 {
+		return errors.New("grace period must not be negative")
+	}
+	if _, err := ecloud.ParseLabelSelector(o.LabelSelector); err != nil {
+		return err
+	}
+	if o.Networks && o.LabelSelector == "" {
+		return errors.New("collecting networks requires a label selector")
+	}
+	return nil
+}
+
+// Orphan is a resource found orphaned by the collector.
+type Orphan struct {
+	Kind   Kind
+	ID     string
+	Name   string
+	Age    time.Duration // How long the resource has been orphaned, at least
+	Action Action
+	Err    error // Error of the deletion, if it failed
+}
+
+// Report is the result of a collection.
+type Report struct {
+	Orphans []Orphan
+}
+
+// Deleted returns the orphans that were deleted.
+func (r *Report) Deleted() []Orphan {
+	deleted := []Orphan{}
+	for _, orphan := range r.Orphans {
+		if orphan.Action == ActionDeleted {
+			deleted = append(deleted, orphan)
+		}
+	}
+	return deleted
+}
+
+// Collector finds and deletes orphaned resources. It remembers when it first
+// found each resource orphaned, so it must be long-lived and run periodically
+// to delete anything. A volume is only collected if it is owned by the user
+// and carries the idempotency key of a create call or is named after a server
+// the collector has seen: the volumes of a server deleted before the first
+// run are collected only if it was created with an idempotency key.
+type Collector struct {
+	client *ecloud.Client
+	opts   Options
+	now    func() time.Time
+
+	mu        sync.Mutex
+	firstSeen map[string]time.Time // By kind and ID
+	servers   map[string]bool      // Names of the servers seen by the runs
+}
+
+// New returns a collector using client.
+func New(client *ecloud.Client, opts Options) (*Collector, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.GracePeriod == 0 {
+		opts.GracePeriod = DefaultGracePeriod
+	}
+	return &Collector{
+		client:    client,
+		opts:      opts,
+		now:       time.Now,
+		firstSeen: map[string]time.Time{},
+		servers:   map[string]bool{},
+	}, nil
+}
+
+// Run finds the orphaned resources and deletes the ones past their grace
+// period, unless the collector only reports. Each resource is checked again
+// right before its deletion, and kept if it is in use. The errors of the
+// failed deletions are joined and reported in the orphans.
+func (c *Collector) Run(ctx context.Context) (*Report, error) {
+	servers, err := c.client.GetCompute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	volumes, err := c.client.GetStorage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	var networks schema.ListNetworkResponse
+	if c.opts.Networks {
+		resp, err := c.client.ListNetwork()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list networks: %w", err)
+		}
+		networks = *resp
+	}
+
+	c.mu.Lock()
+	orphans := c.findOrphans(*servers, *volumes, networks)
+	c.mu.Unlock()
+
+	var errs []error
+	for i := range orphans {
+		orphan := &orphans[i]
+		if orphan.Action != ActionDeleted {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			orphan.Action, orphan.Err = ActionFailed, err
+			errs = append(errs, err)
+			continue
+		}
+		orphaned, err := c.stillOrphaned(*orphan)
+		if err != nil {
+			orphan.Action, orphan.Err = ActionFailed, err
+			errs = append(errs, fmt.Errorf("failed to check %s %s: %w", orphan.Kind, orphan.Name, err))
+			continue
+		}
+		if !orphaned {
+			orphan.Action = ActionInUse
+			c.mu.Lock()
+			delete(c.firstSeen, orphanKey(orphan.Kind, orphan.ID))
+			c.mu.Unlock()
+			continue
+		}
+		if err := c.delete(ctx, *orphan); err != nil {
+			orphan.Action, orphan.Err = ActionFailed, err
+			errs = append(errs, fmt.Errorf("failed to delete %s %s: %w", orphan.Kind, orphan.Name, err))
+		}
+	}
+	return &Report{Orphans: orphans}, errors.Join(errs...)
+}
+
+// stillOrphaned reports whether the orphan is still unused, listing the
+// servers again.
+func (c *Collector) stillOrphaned(orphan Orphan) (bool, error) {
+	servers, err := c.client.GetCompute()
+	if err != nil {
+		return false, fmt.Errorf("failed to list servers: %w", err)
+	}
+	usedVolumes, usedNetworks := inUse(*servers)
+	switch orphan.Kind {
+	case KindVolume:
+		resp, err := c.client.GetStorageByID(schema.GetStorageByIDRequest{VolumeID: orphan.ID})
+		if err != nil {
+			return false, err
+		}
+		vol := resp.Volume
+		vol.VolumeID = orphan.ID
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return isOrphanedVolume(vol, usedVolumes, c.servers), nil
+	case KindNetwork:
+		return !usedNetworks[orphan.ID] && !usedNetworks[orphan.Name], nil
+	default:
+		return false, fmt.Errorf("unknown kind %q", orphan.Kind)
+	}
+}
+
+func (c *Collector) delete(ctx context.Context, orphan Orphan) error {
+	switch orphan.Kind {
+	case KindVolume:
+		_, err := c.client.Volume.Delete(ctx, orphan.ID, ecloud.VolumeDeleteOpts{})
+		return err
+	case KindNetwork:
+		_, _, err := c.client.Network.Delete(ctx, orphan.ID)
+		return err
+	default:
+		return fmt.Errorf("unknown kind %q", orphan.Kind)
+	}
+}
+
+// findOrphans returns the orphaned resources, with the action the collector
+// takes on them: ActionDeleted stands for the planned deletion. The caller
+// must hold c.mu.
+func (c *Collector) findOrphans(servers []schema.Server, volumes []schema.StorageVolume, networks []schema.Network) []Orphan {
+	selector, _ := ecloud.ParseLabelSelector(c.opts.LabelSelector)
+	now := c.now()
+	usedVolumes, usedNetworks := inUse(servers)
+	for _, s := range servers {
+		if name := serverName(s); name != "" {
+			c.servers[name] = true
+		}
+	}
+
+	seen := map[string]time.Time{}
+	orphans := []Orphan{}
+	add := func(kind Kind, id, name string) {
+		key := orphanKey(kind, id)
+		first, ok := c.firstSeen[key]
+		if !ok {
+			first = now
+		}
+		seen[key] = first
+
+		orphan := Orphan{Kind: kind, ID: id, Name: name, Age: now.Sub(first)}
+		switch {
+		case orphan.Age < c.opts.GracePeriod:
+			orphan.Action = ActionPending
+		case c.opts.ReportOnly:
+			orphan.Action = ActionReported
+		default:
+			orphan.Action = ActionDeleted
+		}
+		orphans = append(orphans, orphan)
+	}
+
+	for _, vol := range volumes {
+		if !isOrphanedVolume(vol, usedVolumes, c.servers) || !selector.Matches(vol.Labels) {
+			continue
+		}
+		add(KindVolume, vol.VolumeID, vol.Name)
+	}
+	for _, network := range networks {
+		if usedNetworks[network.NetworkID] || usedNetworks[network.Name] || (network.LibvirtNetwork != "" && usedNetworks[network.LibvirtNetwork]) {
+			continue
+		}
+		if !selector.Matches(network.Labels) {
+			continue
+		}
+		add(KindNetwork, network.NetworkID, network.Name)
+	}
+
+	// Resources no longer orphaned start their grace period again
+	c.firstSeen = seen
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		if orphans[i].Kind != orphans[j].Kind {
+			return orphans[i].Kind > orphans[j].Kind // Volumes first, networks are used by them
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+	return orphans
+}
+
+// orphanKey returns the key of a resource in Collector.firstSeen.
+func orphanKey(kind Kind, id string) string {
+	return string(kind) + "/" + id
+}
+
+// inUse returns the IDs of the volumes and the IDs and names of the networks
+// used by servers. The volumes detached from a server with
+// VolumeClient.Detach are in use while the server exists.
+func inUse(servers []schema.Server) (map[string]bool, map[string]bool) {
+	volumes, networks := map[string]bool{}, map[string]bool{}
+	for _, s := range servers {
+		for _, id := range ecloud.DetachedVolumes(s.Labels) {
+			volumes[id] = true
+		}
+		for _, vol := range s.Volumes {
+			volumes[vol.VolumeID] = true
+		}
+		for _, vol := range s.ReqJSON.Volumes {
+			volumes[vol.VolumeID] = true
+		}
+		if source := s.NetworkConfig.Source; source != "" {
+			networks[source] = true
+		}
+		for _, netdev := range s.ReqJSON.NetDevs {
+			networks[netdev] = true
+		}
+	}
+	return volumes, networks
+}
+
+// serverName returns the name of the server s.
+func serverName(s schema.Server) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.ReqJSON.VMName
+}
+
+// isOrphanedVolume reports whether vol is a volume of the user created for a
+// server, attached to none. Volumes created for servers carry the idempotency
+// key of the create call, or are named after one of servers: the data volume
+// of ServerType.Disk exactly, the others with a volumeNamePattern suffix.
+// Snapshots are never orphaned.
+func isOrphanedVolume(vol schema.StorageVolume, used map[string]bool, servers map[string]bool) bool {
+	if !vol.Own || used[vol.VolumeID] || vol.Nservers > 0 || len(vol.Servers) > 0 {
+		return false
+	}
+	if _, ok := vol.Labels[ecloud.LabelSnapshotOf]; ok {
+		return false
+	}
+	if _, created := vol.Labels[ecloud.LabelIdempotencyKey]; created {
+		return true
+	}
+	if servers[vol.Name] {
+		return true
+	}
+	suffix := volumeNamePattern.FindStringIndex(vol.Name)
+	return suffix != nil && servers[vol.Name[:suffix[0]]]
+}
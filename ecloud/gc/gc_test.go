@@ -0,0 +1,121 @@
+package gc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud"
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestIsOrphanedVolume(t *testing.T) {
+	used := map[string]bool{"used": true}
+
+	servers := map[string]bool{"node-1": true}
+
+	tests := []struct {
+		name string
+		vol  schema.StorageVolume
+		want bool
+	}{
+		{name: "Boot volume", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-1-boot", Own: true}, want: true},
+		{name: "Cloud-init volume", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-1-cloudinit", Own: true}, want: true},
+		{name: "Data volume", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-1-data-0", Own: true}, want: true},
+		{name: "Legacy data volume", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-1", Own: true}, want: true},
+		{name: "Idempotency key", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-2", Own: true, Labels: map[string]string{ecloud.LabelIdempotencyKey: "k"}}, want: true},
+		{name: "User volume", vol: schema.StorageVolume{VolumeID: "v1", Name: "backups", Own: true}},
+		{name: "User volume with a server suffix", vol: schema.StorageVolume{VolumeID: "v1", Name: "postgres-data-1", Own: true}},
+		{name: "Not owned", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-1-boot"}},
+		{name: "Used by a server", vol: schema.StorageVolume{VolumeID: "used", Name: "node-1-boot", Own: true}},
+		{name: "Attached", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-1-boot", Own: true, Nservers: 1}},
+		{name: "Snapshot", vol: schema.StorageVolume{VolumeID: "v1", Name: "node-1-data-0", Own: true, Labels: map[string]string{ecloud.LabelSnapshotOf: "v0"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOrphanedVolume(tt.vol, used, servers); got != tt.want {
+				t.Errorf("isOrphanedVolume() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	servers := []schema.Server{{
+		Name:          "node-1",
+		Volumes:       []schema.StorageVolume{{VolumeID: "boot-1"}},
+		NetworkConfig: schema.NetworkConfig{Source: "cluster-net"},
+		Labels:        map[string]string{ecloud.LabelDetachedVolumes: "data-1"},
+	}}
+	volumes := []schema.StorageVolume{
+		{VolumeID: "boot-1", Name: "node-1-boot", Own: true},
+		{VolumeID: "data-1", Name: "node-1-data-0", Own: true},
+		{VolumeID: "boot-2", Name: "node-2-boot", Own: true},
+		{VolumeID: "cloudinit-2", Name: "node-2-cloudinit", Own: true},
+		{VolumeID: "data-3", Name: "node-3-data-0", Own: true},
+	}
+	networks := []schema.Network{
+		{NetworkID: "n1", Name: "cluster-net"},
+		{NetworkID: "n2", Name: "stray-net"},
+	}
+
+	// node-2 was seen by an earlier run, node-3 never was: its volume is not
+	// known to be created for a server. The age is how long the collector has
+	// seen the resources orphaned.
+	c := &Collector{
+		opts:      Options{GracePeriod: time.Hour, Networks: true},
+		now:       func() time.Time { return now },
+		firstSeen: map[string]time.Time{},
+		servers:   map[string]bool{"node-2": true},
+	}
+	orphans := c.findOrphans(servers, volumes, networks)
+
+	want := map[string]Action{"boot-2": ActionPending, "cloudinit-2": ActionPending, "n2": ActionPending}
+	if len(orphans) != len(want) {
+		t.Fatalf("findOrphans() = %+v, want %d orphans", orphans, len(want))
+	}
+	for _, orphan := range orphans {
+		if orphan.Action != want[orphan.ID] {
+			t.Errorf("%s %s: action = %q, want %q", orphan.Kind, orphan.ID, orphan.Action, want[orphan.ID])
+		}
+	}
+	if orphans[len(orphans)-1].Kind != KindNetwork {
+		t.Errorf("networks must come after volumes: %+v", orphans)
+	}
+
+	// A volume found attached again, e.g. once its server is registered
+	// again, starts its grace period again
+	now = now.Add(30 * time.Minute)
+	attached := append([]schema.Server{{Name: "node-2", Volumes: []schema.StorageVolume{{VolumeID: "boot-2"}}}}, servers...)
+	c.findOrphans(attached, volumes, networks)
+
+	// The resources are deleted once orphaned for the grace period
+	now = now.Add(30 * time.Minute)
+	want = map[string]Action{"boot-2": ActionPending, "cloudinit-2": ActionDeleted, "n2": ActionDeleted}
+	for _, orphan := range c.findOrphans(servers, volumes, networks) {
+		if orphan.Action != want[orphan.ID] {
+			t.Errorf("%s %s: action = %q, want %q", orphan.Kind, orphan.ID, orphan.Action, want[orphan.ID])
+		}
+	}
+
+	now = now.Add(time.Hour)
+	c.opts.ReportOnly = true
+	for _, orphan := range c.findOrphans(servers, volumes, networks) {
+		if orphan.Action != ActionReported {
+			t.Errorf("%s %s: action = %q, want reported", orphan.Kind, orphan.ID, orphan.Action)
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	if err := (Options{Networks: true}).Validate(); err == nil {
+		t.Errorf("expected an error collecting networks without a label selector")
+	}
+	if err := (Options{Networks: true, LabelSelector: "cluster=test"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Options{GracePeriod: -time.Minute}).Validate(); err == nil {
+		t.Errorf("expected an error for a negative grace period")
+	}
+}
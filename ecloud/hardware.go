@@ -0,0 +1,139 @@
+package ecloud
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// defaultCPUFlags are required when a server asks for no CPU flag.
+var defaultCPUFlags = []string{"sse2"}
+
+// PCIDeviceSelector selects a PCI device to pass through to a server, by its
+// vendor and device IDs (e.g. "10de:1eb8" for an NVIDIA T4).
+type PCIDeviceSelector string
+
+var (
+	cpuFlagRegexp           = regexp.MustCompile(`^[a-z0-9_.]+$`)
+	pciDeviceSelectorRegexp = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{4}$`)
+)
+
+// Validate checks if the selector is valid.
+func (s PCIDeviceSelector) Validate() error {
+	if !pciDeviceSelectorRegexp.MatchString(strings.ToLower(string(s))) {
+		return fmt.Errorf("invalid PCI device selector %q, expected vendor:device (e.g. 10de:1eb8)", s)
+	}
+	return nil
+}
+
+// validateHardware checks the syntax of the hardware options of opts.
+func (o ServerCreateOpts) validateHardware() error {
+	for _, flag := range o.CPUFlags {
+		if !cpuFlagRegexp.MatchString(flag) {
+			return fmt.Errorf("invalid CPU flag %q", flag)
+		}
+	}
+	if o.Overprovision < 0 {
+		return fmt.Errorf("overprovision must not be negative")
+	}
+	for _, device := range o.PCIDevices {
+		if err := device.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultOverprovision is the overprovision ratio, in vCPUs per physical core,
+// when neither the server nor its compute template sets one.
+const defaultOverprovision = 1
+
+// applyHardware sets the CPU, RAM and PCI requirements of reqBody from the
+// resolved size and the hardware options of opts. Options stricter than the
+// compute template of the size are accepted, looser ones are rejected.
+func applyHardware(reqBody *schema.CreateComputeRequest, opts ServerCreateOpts, size *ServerSizeConfig) error {
+	if size.Slots <= 0 || size.Ramsize <= 0 {
+		return Error{
+			Code:    ErrorCodeInvalidServerType,
+			Message: fmt.Sprintf("server type %s has %d slots and %d MB of RAM", opts.ServerType.Name, size.Slots, size.Ramsize),
+		}
+	}
+	reqBody.Slots = size.Slots
+	reqBody.Ramsize = size.Ramsize
+	reqBody.AllowSMT = opts.AllowSMT
+	reqBody.ReqECC = opts.ReqECC
+	reqBody.Overprovision = opts.Overprovision
+	reqBody.Flags = append([]string{}, opts.CPUFlags...)
+
+	// Use the ServerType's architecture if specified, otherwise default to x86_64
+	if opts.ServerType.Architecture != "" {
+		reqBody.Archs = []string{string(opts.ServerType.Architecture)}
+	} else {
+		reqBody.Archs = []string{string(ArchitectureX86_64)}
+	}
+
+	if template := size.template; template != nil {
+		if reqBody.Overprovision == 0 {
+			reqBody.Overprovision = template.CPU.Overprovision
+		}
+		if err := applyTemplate(reqBody, template); err != nil {
+			return err
+		}
+	}
+	if reqBody.Overprovision == 0 {
+		reqBody.Overprovision = defaultOverprovision
+	}
+	if len(reqBody.Flags) == 0 {
+		reqBody.Flags = append(reqBody.Flags, defaultCPUFlags...)
+	}
+
+	reqBody.Pci = make([]string, len(opts.PCIDevices))
+	for i, device := range opts.PCIDevices {
+		reqBody.Pci[i] = strings.ToLower(string(device))
+	}
+	return nil
+}
+
+// applyTemplate checks the hardware requirements of reqBody against the limits
+// of template and adds the requirements of template (ECC, CPU flags) to them.
+func applyTemplate(reqBody *schema.CreateComputeRequest, template *schema.ComputeTemplate) error {
+	invalid := func(format string, args ...interface{}) error {
+		return Error{
+			Code:    ErrorCodeInvalidServerType,
+			Message: fmt.Sprintf("server type %s: ", template.Info.Name) + fmt.Sprintf(format, args...),
+		}
+	}
+
+	if reqBody.AllowSMT && !template.CPU.AllowSMT {
+		return invalid("SMT is not allowed")
+	}
+	if max := template.CPU.Overprovision; max > 0 && reqBody.Overprovision > max {
+		return invalid("overprovision %d exceeds the maximum of %d", reqBody.Overprovision, max)
+	}
+	if len(template.CPU.Archs) > 0 {
+		for _, arch := range reqBody.Archs {
+			if !containsFold(template.CPU.Archs, arch) {
+				return invalid("architecture %s is not one of %s", arch, strings.Join(template.CPU.Archs, ", "))
+			}
+		}
+	}
+	reqBody.ReqECC = reqBody.ReqECC || template.RAM.ReqECC
+	for _, flag := range template.CPU.Flags {
+		if !containsFold(reqBody.Flags, flag) {
+			reqBody.Flags = append(reqBody.Flags, flag)
+		}
+	}
+	return nil
+}
+
+// containsFold reports whether values contains s, ignoring case.
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
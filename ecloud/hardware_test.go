@@ -0,0 +1,147 @@
+package ecloud
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestApplyHardware(t *testing.T) {
+	template := &schema.ComputeTemplate{}
+	template.Info.Name = "gpu"
+	template.CPU.Slots = 4
+	template.CPU.Overprovision = 2
+	template.CPU.Archs = []string{"X86_64"}
+	template.CPU.Flags = []string{"avx2"}
+	template.RAM.Ramsize = 8192
+	template.RAM.ReqECC = true
+
+	tests := []struct {
+		name     string
+		opts     ServerCreateOpts
+		size     *ServerSizeConfig
+		expected schema.CreateComputeRequest
+		wantErr  bool
+	}{
+		{
+			name: "Defaults",
+			opts: ServerCreateOpts{ServerType: &ServerType{Name: "neon"}},
+			size: &ServerSizeConfig{Slots: 2, Ramsize: 2048},
+			expected: schema.CreateComputeRequest{
+				Slots: 2, Overprovision: 1, Ramsize: 2048,
+				Archs: []string{"X86_64"}, Flags: []string{"sse2"}, Pci: []string{},
+			},
+		},
+		{
+			name: "Explicit options",
+			opts: ServerCreateOpts{
+				ServerType:    &ServerType{Name: "neon"},
+				CPUFlags:      []string{"avx512f"},
+				AllowSMT:      true,
+				ReqECC:        true,
+				Overprovision: 1,
+				PCIDevices:    []PCIDeviceSelector{"10DE:1EB8"},
+			},
+			size: &ServerSizeConfig{Slots: 2, Ramsize: 2048},
+			expected: schema.CreateComputeRequest{
+				Slots: 2, Overprovision: 1, Ramsize: 2048, AllowSMT: true, ReqECC: true,
+				Archs: []string{"X86_64"}, Flags: []string{"avx512f"}, Pci: []string{"10de:1eb8"},
+			},
+		},
+		{
+			name: "Template requirements",
+			opts: ServerCreateOpts{ServerType: &ServerType{Name: "gpu"}, CPUFlags: []string{"sse4_2"}},
+			size: &ServerSizeConfig{Slots: 4, Ramsize: 8192, template: template},
+			expected: schema.CreateComputeRequest{
+				Slots: 4, Overprovision: 2, Ramsize: 8192, ReqECC: true,
+				Archs: []string{"X86_64"}, Flags: []string{"sse4_2", "avx2"}, Pci: []string{},
+			},
+		},
+		{
+			name:    "Size without slots",
+			opts:    ServerCreateOpts{ServerType: &ServerType{Name: "gpu"}},
+			size:    &ServerSizeConfig{Ramsize: 8192, template: template},
+			wantErr: true,
+		},
+		{
+			name:    "Overprovision above the template",
+			opts:    ServerCreateOpts{ServerType: &ServerType{Name: "gpu"}, Overprovision: 4},
+			size:    &ServerSizeConfig{Slots: 4, Ramsize: 8192, template: template},
+			wantErr: true,
+		},
+		{
+			name:    "SMT not allowed by the template",
+			opts:    ServerCreateOpts{ServerType: &ServerType{Name: "gpu"}, AllowSMT: true},
+			size:    &ServerSizeConfig{Slots: 4, Ramsize: 8192, template: template},
+			wantErr: true,
+		},
+		{
+			name:    "Architecture not supported by the template",
+			opts:    ServerCreateOpts{ServerType: &ServerType{Name: "gpu", Architecture: ArchitectureX86_32}},
+			size:    &ServerSizeConfig{Slots: 4, Ramsize: 8192, template: template},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reqBody schema.CreateComputeRequest
+			err := applyHardware(&reqBody, tt.opts, tt.size)
+			if tt.wantErr {
+				if !IsError(err, ErrorCodeInvalidServerType) {
+					t.Fatalf("applyHardware() error = %v, want %s", err, ErrorCodeInvalidServerType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyHardware() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(reqBody, tt.expected) {
+				t.Errorf("applyHardware() = %+v, want %+v", reqBody, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServerCreateOptsValidateHardware(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ServerCreateOpts
+		wantErr bool
+	}{
+		{name: "Valid", opts: ServerCreateOpts{CPUFlags: []string{"avx2", "sse4_2"}, PCIDevices: []PCIDeviceSelector{"10de:1eb8"}}},
+		{name: "Invalid CPU flag", opts: ServerCreateOpts{CPUFlags: []string{"AVX 2"}}, wantErr: true},
+		{name: "Negative overprovision", opts: ServerCreateOpts{Overprovision: -1}, wantErr: true},
+		{name: "Invalid PCI selector", opts: ServerCreateOpts{PCIDevices: []PCIDeviceSelector{"nvidia"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validateHardware(); (err != nil) != tt.wantErr {
+				t.Errorf("validateHardware() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyTemplate(t *testing.T) {
+	template := &schema.ComputeTemplate{}
+	template.Info.Name = "neon"
+	template.CPU.Overprovision = 2
+	template.CPU.Flags = []string{"avx2"}
+
+	// A registered server keeps its options within the limits of the template
+	reqBody := schema.CreateComputeRequest{Overprovision: 2, Archs: []string{"X86_64"}, Flags: []string{"sse2"}}
+	if err := applyTemplate(&reqBody, template); err != nil {
+		t.Fatalf("applyTemplate() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(reqBody.Flags, []string{"sse2", "avx2"}) || reqBody.Overprovision != 2 {
+		t.Errorf("unexpected request: %+v", reqBody)
+	}
+
+	reqBody.Overprovision = 3
+	if err := applyTemplate(&reqBody, template); !IsError(err, ErrorCodeInvalidServerType) {
+		t.Errorf("applyTemplate() error = %v, want %s", err, ErrorCodeInvalidServerType)
+	}
+}
@@ -0,0 +1,53 @@
+package ecloud
+
+import (
+	"context"
+	"strings"
+)
+
+// Image is a boot image servers can be created from.
+type Image struct {
+	Name      string
+	OSFamily  string
+	OSFlavour string
+	URL       string // Cloud image imported into the boot volume
+	Checksum  string // Expected checksum of the image at URL, not verified if empty
+}
+
+// defaultImage is used for the images missing from the catalog. It has no
+// checksum, the image at URL being rebuilt daily.
+// TODO: only ubuntu image supported for now, add more os and version support in the future
+var defaultImage = Image{
+	Name:      "ubuntu-22-04",
+	OSFamily:  "linux",
+	OSFlavour: "ubuntu",
+	URL:       "https://cloud-images.ubuntu.com/jammy/current/jammy-server-cloudimg-amd64.img",
+}
+
+// imageCatalog lists the known boot images by name.
+var imageCatalog = map[string]Image{
+	defaultImage.Name: defaultImage,
+}
+
+// resolveImage returns the boot image for an image name (e.g., "ubuntu-24-04").
+// Images missing from the catalog keep the OS parsed from their name and boot
+// from the default image.
+func resolveImage(ctx context.Context, name string) *Image {
+	normalizedName := strings.ToLower(strings.TrimSpace(name))
+
+	cache := lookupCacheFrom(ctx)
+	if image, ok := cache.image(normalizedName); ok {
+		return image
+	}
+
+	image := defaultImage
+	if catalogImage, ok := imageCatalog[normalizedName]; ok {
+		image = catalogImage
+	} else {
+		image.Name = normalizedName
+		image.OSFamily, image.OSFlavour = parseImageToOS(name)
+	}
+
+	cache.setImage(normalizedName, &image)
+	return &image
+}
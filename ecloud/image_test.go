@@ -0,0 +1,57 @@
+package ecloud
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolveImage(t *testing.T) {
+	tests := []struct {
+		name           string
+		image          string
+		expectedFamily string
+		expectedFlavor string
+		expectedURL    string
+	}{
+		{
+			name:           "Catalog image",
+			image:          "Ubuntu-22-04",
+			expectedFamily: "linux",
+			expectedFlavor: "ubuntu",
+			expectedURL:    defaultImage.URL,
+		},
+		{
+			name:           "Image missing from the catalog",
+			image:          "debian-12",
+			expectedFamily: "linux",
+			expectedFlavor: "debian",
+			expectedURL:    defaultImage.URL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := resolveImage(context.Background(), tt.image)
+			if image.OSFamily != tt.expectedFamily || image.OSFlavour != tt.expectedFlavor {
+				t.Errorf("resolveImage() OS = %s/%s, want %s/%s", image.OSFamily, image.OSFlavour, tt.expectedFamily, tt.expectedFlavor)
+			}
+			if image.URL != tt.expectedURL {
+				t.Errorf("resolveImage() URL = %s, want %s", image.URL, tt.expectedURL)
+			}
+		})
+	}
+}
+
+func TestResolveImageCached(t *testing.T) {
+	ctx := withLookupCache(context.Background())
+
+	first := resolveImage(ctx, "debian-12")
+	second := resolveImage(ctx, " Debian-12 ")
+	if first != second {
+		t.Errorf("expected the cached image to be reused")
+	}
+
+	if resolveImage(context.Background(), "debian-12") == first {
+		t.Errorf("expected no caching without a lookup cache")
+	}
+}
@@ -0,0 +1,186 @@
+package ecloud
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SelectorOperator specifies the operator of a label selector requirement.
+type SelectorOperator string
+
+// List of supported label selector operators.
+const (
+	SelectorOpEquals       SelectorOperator = "="
+	SelectorOpNotEquals    SelectorOperator = "!="
+	SelectorOpIn           SelectorOperator = "in"
+	SelectorOpNotIn        SelectorOperator = "notin"
+	SelectorOpExists       SelectorOperator = "exists"
+	SelectorOpDoesNotExist SelectorOperator = "!"
+)
+
+// LabelRequirement is a single condition of a label selector.
+type LabelRequirement struct {
+	Key      string
+	Operator SelectorOperator
+	Values   []string
+}
+
+// LabelSelector is a parsed Kubernetes-style label selector, e.g.
+// "cluster=test.k8s,role in (master,node),!deleted".
+// The zero value matches every set of labels.
+type LabelSelector struct {
+	Requirements []LabelRequirement
+}
+
+var setRequirementPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseLabelSelector parses a label selector. Requirements are separated by
+// commas and use one of the forms "key=value", "key==value", "key!=value",
+// "key in (v1,v2)", "key notin (v1,v2)", "key" (exists) and "!key".
+func ParseLabelSelector(selector string) (*LabelSelector, error) {
+	s := &LabelSelector{}
+	if strings.TrimSpace(selector) == "" {
+		return s, nil
+	}
+
+	parts, err := splitSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		req, err := parseLabelRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		s.Requirements = append(s.Requirements, req)
+	}
+	return s, nil
+}
+
+// splitSelector splits a selector on the commas outside of parentheses.
+func splitSelector(selector string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range selector {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, invalidSelectorError(selector, "unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, invalidSelectorError(selector, "unbalanced parentheses")
+	}
+	return append(parts, selector[start:]), nil
+}
+
+func parseLabelRequirement(part string) (LabelRequirement, error) {
+	part = strings.TrimSpace(part)
+	if part == "" {
+		return LabelRequirement{}, invalidSelectorError(part, "empty requirement")
+	}
+
+	var req LabelRequirement
+	switch {
+	case strings.HasPrefix(part, "!") && !strings.Contains(part, "="):
+		req = LabelRequirement{Key: strings.TrimSpace(part[1:]), Operator: SelectorOpDoesNotExist}
+
+	case setRequirementPattern.MatchString(part):
+		m := setRequirementPattern.FindStringSubmatch(part)
+		req = LabelRequirement{Key: m[1], Operator: SelectorOperator(m[2])}
+		for _, v := range strings.Split(m[3], ",") {
+			req.Values = append(req.Values, strings.TrimSpace(v))
+		}
+
+	case strings.Contains(part, "!="):
+		key, value, _ := strings.Cut(part, "!=")
+		req = LabelRequirement{Key: strings.TrimSpace(key), Operator: SelectorOpNotEquals, Values: []string{strings.TrimSpace(value)}}
+
+	case strings.Contains(part, "="):
+		key, value, _ := strings.Cut(part, "=")
+		value = strings.TrimPrefix(value, "=")
+		req = LabelRequirement{Key: strings.TrimSpace(key), Operator: SelectorOpEquals, Values: []string{strings.TrimSpace(value)}}
+
+	default:
+		req = LabelRequirement{Key: part, Operator: SelectorOpExists}
+	}
+
+	if req.Key == "" || strings.ContainsAny(req.Key, " \t!=(),") {
+		return LabelRequirement{}, invalidSelectorError(part, "invalid label key")
+	}
+	for _, v := range req.Values {
+		if strings.ContainsAny(v, " \t!=(),") {
+			return LabelRequirement{}, invalidSelectorError(part, "invalid label value")
+		}
+	}
+	return req, nil
+}
+
+func invalidSelectorError(selector string, reason string) error {
+	return Error{
+		Code:    ErrorCodeInvalidInput,
+		Message: fmt.Sprintf("invalid label selector %q: %s", selector, reason),
+	}
+}
+
+// Matches reports whether labels satisfy every requirement of the selector.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for _, req := range s.Requirements {
+		if !req.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether labels satisfy the requirement.
+func (r LabelRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorOpExists:
+		return ok
+	case SelectorOpDoesNotExist:
+		return !ok
+	case SelectorOpEquals:
+		return ok && value == r.Values[0]
+	case SelectorOpNotEquals:
+		return !ok || value != r.Values[0]
+	case SelectorOpIn:
+		return ok && slices.Contains(r.Values, value)
+	case SelectorOpNotIn:
+		return !ok || !slices.Contains(r.Values, value)
+	}
+	return false
+}
+
+// String returns the selector in its textual form.
+func (s *LabelSelector) String() string {
+	parts := make([]string, len(s.Requirements))
+	for i, req := range s.Requirements {
+		switch req.Operator {
+		case SelectorOpExists:
+			parts[i] = req.Key
+		case SelectorOpDoesNotExist:
+			parts[i] = "!" + req.Key
+		case SelectorOpIn, SelectorOpNotIn:
+			parts[i] = fmt.Sprintf("%s %s (%s)", req.Key, req.Operator, strings.Join(req.Values, ","))
+		default:
+			parts[i] = req.Key + string(req.Operator) + req.Values[0]
+		}
+	}
+	return strings.Join(parts, ",")
+}
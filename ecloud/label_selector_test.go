@@ -0,0 +1,74 @@
+package ecloud
+
+import (
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	labels := map[string]string{
+		"cluster":        "test.k8s",
+		"role":           "master",
+		"instance-group": "master-eu-south-1",
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		expected bool
+	}{
+		{name: "Empty selector", selector: "", expected: true},
+		{name: "Equals", selector: "cluster=test.k8s", expected: true},
+		{name: "Double equals", selector: "cluster==test.k8s", expected: true},
+		{name: "Equals mismatch", selector: "cluster=prod.k8s", expected: false},
+		{name: "Not equals", selector: "cluster!=prod.k8s", expected: true},
+		{name: "Not equals missing key", selector: "zone!=eu", expected: true},
+		{name: "In", selector: "role in (master,node)", expected: true},
+		{name: "In mismatch", selector: "role in (node, bastion)", expected: false},
+		{name: "Not in", selector: "role notin (node,bastion)", expected: true},
+		{name: "Exists", selector: "instance-group", expected: true},
+		{name: "Exists missing key", selector: "zone", expected: false},
+		{name: "Does not exist", selector: "!zone", expected: true},
+		{name: "Does not exist present key", selector: "!role", expected: false},
+		{name: "Multiple requirements", selector: "cluster=test.k8s, role in (master,node), !zone", expected: true},
+		{name: "Multiple requirements mismatch", selector: "cluster=test.k8s,role=node", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseLabelSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("ParseLabelSelector(%q) unexpected error: %v", tt.selector, err)
+			}
+			if got := selector.Matches(labels); got != tt.expected {
+				t.Errorf("ParseLabelSelector(%q).Matches() = %v, want %v", tt.selector, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseLabelSelectorInvalid(t *testing.T) {
+	invalid := []string{
+		"role in (master,node",
+		"cluster=test.k8s,,role=master",
+		"=value",
+		"role in (master)) ",
+		"my key=value",
+	}
+
+	for _, selector := range invalid {
+		if _, err := ParseLabelSelector(selector); !IsError(err, ErrorCodeInvalidInput) {
+			t.Errorf("ParseLabelSelector(%q) expected invalid input error, got %v", selector, err)
+		}
+	}
+}
+
+func TestLabelSelectorString(t *testing.T) {
+	selector, err := ParseLabelSelector("cluster==test.k8s,role notin (node, bastion),!zone,instance-group")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "cluster=test.k8s,role notin (node,bastion),!zone,instance-group"
+	if got := selector.String(); got != expected {
+		t.Errorf("String() = %q, want %q", got, expected)
+	}
+}
@@ -0,0 +1,195 @@
+package ecloud
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Label keys set by the client on the resources it creates.
+const (
+	// LabelIdempotencyKey carries the idempotency key of the create call that
+	// produced a resource, so that a retried call can adopt it.
+	LabelIdempotencyKey = "ecloud.elemento.cloud/idempotency-key"
+
+	// LabelPlacementGroup and LabelPlacementGroupType store the placement
+	// group of a server, see PlacementGroup.
+	LabelPlacementGroup     = "ecloud.elemento.cloud/placement-group"
+	LabelPlacementGroupType = "ecloud.elemento.cloud/placement-group-type"
+
+	// LabelProvider and LabelRegion record where a server was allocated.
+	LabelProvider = "ecloud.elemento.cloud/provider"
+	LabelRegion   = "ecloud.elemento.cloud/region"
+
+	// LabelClonedFrom stores the ID of the volume a volume was cloned from.
+	LabelClonedFrom = "ecloud.elemento.cloud/cloned-from"
+
+	// LabelSnapshotOf and LabelSnapshotTime mark a volume as a snapshot of the
+	// volume with the given ID, taken at the given time in Unix seconds.
+	LabelSnapshotOf   = "ecloud.elemento.cloud/snapshot-of"
+	LabelSnapshotTime = "ecloud.elemento.cloud/snapshot-time"
+
+	// LabelSSHKeys stores the SSH keys authorized for root on a server, one per
+	// line by fingerprint, or by name if the public key cannot be parsed, so
+	// that a rebuild looks them up and authorizes them again. It is "none" if
+	// root logs in with a password.
+	LabelSSHKeys = "ecloud.elemento.cloud/ssh-keys"
+
+	// LabelDetachedVolumes lists the IDs of the volumes detached from a server
+	// with VolumeClient.Detach, one per line, so that they are not collected
+	// as orphans while the server exists.
+	LabelDetachedVolumes = "ecloud.elemento.cloud/detached-volumes"
+
+	// LabelDataDisks stores the data disks of a server mounted by cloud-init,
+	// one "<device> <filesystem> <mount point>" per line, so that a rebuild
+	// mounts them again.
+	LabelDataDisks = "ecloud.elemento.cloud/data-disks"
+)
+
+// mergeLabels returns a new map containing labels and extra, extra winning on conflicts.
+func mergeLabels(labels map[string]string, extra map[string]string) map[string]string {
+	if len(labels) == 0 && len(extra) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(labels)+len(extra))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// idempotencyLabels returns labels with the idempotency key added if set.
+func idempotencyLabels(labels map[string]string, key string) map[string]string {
+	if key == "" {
+		return mergeLabels(labels, nil)
+	}
+	return mergeLabels(labels, map[string]string{LabelIdempotencyKey: key})
+}
+
+// noSSHKeys is the value of LabelSSHKeys on a server without SSH keys.
+const noSSHKeys = "none"
+
+// sshKeyLabels returns the label recording the keys with a public key.
+func sshKeyLabels(keys []*SSHKey) (map[string]string, error) {
+	refs := []string{}
+	for _, key := range keys {
+		if key == nil || key.PublicKey == "" {
+			continue
+		}
+		ref := key.Fingerprint
+		if ref == "" {
+			ref, _ = sshKeyFingerprint(key.PublicKey)
+		}
+		if ref == "" {
+			ref = key.Name
+		}
+		if ref == "" || strings.ContainsAny(ref, "\n") {
+			return nil, fmt.Errorf("SSH key %q has no valid public key nor name to record it by", key.PublicKey)
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return map[string]string{LabelSSHKeys: noSSHKeys}, nil
+	}
+	return map[string]string{LabelSSHKeys: strings.Join(refs, "\n")}, nil
+}
+
+// labelledSSHKeys returns the fingerprints or names of the keys recorded in
+// labels by sshKeyLabels, and false if labels do not record them.
+func labelledSSHKeys(labels map[string]string) ([]string, bool) {
+	value, ok := labels[LabelSSHKeys]
+	if !ok {
+		return nil, false
+	}
+	refs := []string{}
+	if strings.TrimSpace(value) == noSSHKeys {
+		return refs, true
+	}
+	for _, ref := range strings.Split(value, "\n") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, len(refs) > 0
+}
+
+// dataDiskLabels returns the label storing the mounted disks, nil if there is none.
+func dataDiskLabels(disks []attachedDisk) map[string]string {
+	lines := []string{}
+	for _, disk := range disks {
+		if disk.MountPoint != "" {
+			lines = append(lines, fmt.Sprintf("%s %s %s", disk.Device, disk.filesystem(), disk.MountPoint))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return map[string]string{LabelDataDisks: strings.Join(lines, "\n")}
+}
+
+// labelledDataDisks returns the disks stored in labels by dataDiskLabels,
+// skipping malformed lines.
+func labelledDataDisks(labels map[string]string) []attachedDisk {
+	disks := []attachedDisk{}
+	for _, line := range strings.Split(labels[LabelDataDisks], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		disks = append(disks, attachedDisk{
+			DiskSpec: DiskSpec{Filesystem: fields[1], MountPoint: fields[2]},
+			Device:   fields[0],
+		})
+	}
+	return disks
+}
+
+// DetachedVolumes returns the IDs of the volumes listed in the
+// LabelDetachedVolumes label of a server.
+func DetachedVolumes(labels map[string]string) []string {
+	ids := []string{}
+	for _, id := range strings.Split(labels[LabelDetachedVolumes], "\n") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// withDetachedVolume returns a copy of the labels of a server with volumeID
+// added to, or removed from, its detached volumes.
+func withDetachedVolume(labels map[string]string, volumeID string, detached bool) map[string]string {
+	ids := []string{}
+	for _, id := range DetachedVolumes(labels) {
+		if id != volumeID {
+			ids = append(ids, id)
+		}
+	}
+	if detached {
+		ids = append(ids, volumeID)
+	}
+
+	result := mergeLabels(labels, nil)
+	if len(ids) == 0 {
+		delete(result, LabelDetachedVolumes)
+		return result
+	}
+	return mergeLabels(result, map[string]string{LabelDetachedVolumes: strings.Join(ids, "\n")})
+}
+
+// checkIdempotencyKey reports whether a resource found by name can be adopted
+// by a create call using key. Resources carrying a different key belong to
+// another call and result in a uniqueness error; resources without the label
+// (e.g. created by a daemon that does not persist labels) are adopted by name.
+func checkIdempotencyKey(kind, name string, labels map[string]string, key string) error {
+	found, ok := labels[LabelIdempotencyKey]
+	if !ok || found == key {
+		return nil
+	}
+	return Error{
+		Code:    ErrorCodeUniquenessError,
+		Message: fmt.Sprintf("%s %q already exists with a different idempotency key", kind, name),
+	}
+}
@@ -0,0 +1,148 @@
+package ecloud
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestIdempotencyLabels(t *testing.T) {
+	labels := map[string]string{"cluster": "test.k8s"}
+
+	got := idempotencyLabels(labels, "retry-1")
+	if got[LabelIdempotencyKey] != "retry-1" || got["cluster"] != "test.k8s" {
+		t.Errorf("unexpected labels: %v", got)
+	}
+	if _, ok := labels[LabelIdempotencyKey]; ok {
+		t.Errorf("idempotencyLabels must not modify its input")
+	}
+
+	if got := idempotencyLabels(nil, ""); got != nil {
+		t.Errorf("expected nil labels, got %v", got)
+	}
+}
+
+func TestCheckIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		expectError bool
+	}{
+		{
+			name:   "Same key",
+			labels: map[string]string{LabelIdempotencyKey: "retry-1"},
+		},
+		{
+			name:   "No label",
+			labels: map[string]string{"cluster": "test.k8s"},
+		},
+		{
+			name:        "Different key",
+			labels:      map[string]string{LabelIdempotencyKey: "retry-2"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkIdempotencyKey("volume", "node-boot", tt.labels, "retry-1")
+			if tt.expectError {
+				if !IsError(err, ErrorCodeUniquenessError) {
+					t.Errorf("expected uniqueness error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSSHKeyLabels(t *testing.T) {
+	_, publicKey, err := generateSSHKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := sshKeyFingerprint(string(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err := sshKeyLabels([]*SSHKey{{Name: "deploy", PublicKey: string(publicKey)}, {Name: "legacy", PublicKey: "ssh-rsa AAAA... legacy@host"}})
+	if err != nil {
+		t.Fatalf("sshKeyLabels() returned error: %v", err)
+	}
+	refs, ok := labelledSSHKeys(labels)
+	if !ok || !reflect.DeepEqual(refs, []string{fingerprint, "legacy"}) {
+		t.Errorf("labelledSSHKeys() = %v, %v, want the fingerprint of the valid key and the name of the other", refs, ok)
+	}
+
+	labels, err = sshKeyLabels(nil)
+	if err != nil || labels[LabelSSHKeys] != noSSHKeys {
+		t.Errorf("sshKeyLabels(nil) = %v, %v, want a label recording no keys", labels, err)
+	}
+	if refs, ok := labelledSSHKeys(labels); !ok || len(refs) != 0 {
+		t.Errorf("labelledSSHKeys() = %v, %v, want no keys", refs, ok)
+	}
+	if _, ok := labelledSSHKeys(map[string]string{"cluster": "test.k8s"}); ok {
+		t.Errorf("expected the keys to be unknown without the label")
+	}
+	if _, err := sshKeyLabels([]*SSHKey{{PublicKey: "not a key"}}); err == nil {
+		t.Errorf("expected an error for a key with neither a valid public key nor a name")
+	}
+}
+
+func TestRecoverSSHKeys(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	client, err := NewClient("test", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := client.SSHKey.Create(ctx, SSHKeyCreateOpts{Name: "deploy", PublicKey: "generated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, err := sshKeyLabels([]*SSHKey{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := client.Server.recoverSSHKeys(ctx, "node-1", labels)
+	if err != nil {
+		t.Fatalf("recoverSSHKeys() returned error: %v", err)
+	}
+	if len(keys) != 1 || keys[0].PublicKey != key.PublicKey || keys[0].Name != "deploy" {
+		t.Errorf("recoverSSHKeys() = %+v, want the key %s", keys, key.Fingerprint)
+	}
+	if keys, err := client.Server.recoverSSHKeys(ctx, "node-1", map[string]string{LabelSSHKeys: "deploy"}); err != nil || len(keys) != 1 {
+		t.Errorf("recoverSSHKeys() = %v, %v, want the key found by name", keys, err)
+	}
+
+	if _, err := client.Server.recoverSSHKeys(ctx, "node-1", map[string]string{}); !IsError(err, ErrorCodeNotFound) {
+		t.Errorf("recoverSSHKeys() = %v, want an error without the label", err)
+	}
+	if _, err := client.Server.recoverSSHKeys(ctx, "node-1", map[string]string{LabelSSHKeys: "SHA256:unknown"}); !IsError(err, ErrorCodeNotFound) {
+		t.Errorf("recoverSSHKeys() = %v, want an error for an unknown key", err)
+	}
+}
+
+func TestDetachedVolumes(t *testing.T) {
+	labels := map[string]string{"cluster": "test.k8s"}
+
+	detached := withDetachedVolume(labels, "v1", true)
+	detached = withDetachedVolume(detached, "v2", true)
+	detached = withDetachedVolume(detached, "v1", true)
+	if ids := DetachedVolumes(detached); !reflect.DeepEqual(ids, []string{"v2", "v1"}) {
+		t.Errorf("DetachedVolumes() = %v, want [v2 v1]", ids)
+	}
+	if _, ok := labels[LabelDetachedVolumes]; ok {
+		t.Errorf("expected the labels not to be modified")
+	}
+
+	attached := withDetachedVolume(withDetachedVolume(detached, "v1", false), "v2", false)
+	if _, ok := attached[LabelDetachedVolumes]; ok || attached["cluster"] != "test.k8s" {
+		t.Errorf("unexpected labels once attached again: %v", attached)
+	}
+}
@@ -0,0 +1,88 @@
+package ecloud
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// lookupCache memoizes the read-only lookups (templates, images, networks)
+// shared by the creations of a batch. A nil *lookupCache caches nothing.
+type lookupCache struct {
+	mu        sync.Mutex
+	templates *schema.ComputeTemplatesResponse
+	images    map[string]*Image
+	networks  map[string]*Network
+}
+
+type lookupCacheKey struct{}
+
+// withLookupCache returns a context carrying a new lookup cache.
+func withLookupCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lookupCacheKey{}, &lookupCache{
+		images:   map[string]*Image{},
+		networks: map[string]*Network{},
+	})
+}
+
+// lookupCacheFrom returns the lookup cache carried by ctx, if any.
+func lookupCacheFrom(ctx context.Context) *lookupCache {
+	cache, _ := ctx.Value(lookupCacheKey{}).(*lookupCache)
+	return cache
+}
+
+// computeTemplates returns the compute templates, fetching them once per cache.
+func (lc *lookupCache) computeTemplates(client *Client) (*schema.ComputeTemplatesResponse, error) {
+	if lc == nil {
+		return client.ComputeTemplates()
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.templates == nil {
+		templates, err := client.ComputeTemplates()
+		if err != nil {
+			return nil, err
+		}
+		lc.templates = templates
+	}
+	return lc.templates, nil
+}
+
+// network returns the network with the given ID, fetching it once per cache.
+func (lc *lookupCache) network(ctx context.Context, client *Client, id string) (*Network, error) {
+	if lc == nil {
+		network, _, err := client.Network.GetByID(ctx, id)
+		return network, err
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if network, ok := lc.networks[id]; ok {
+		return network, nil
+	}
+	network, _, err := client.Network.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	lc.networks[id] = network
+	return network, nil
+}
+
+func (lc *lookupCache) image(name string) (*Image, bool) {
+	if lc == nil {
+		return nil, false
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	image, ok := lc.images[name]
+	return image, ok
+}
+
+func (lc *lookupCache) setImage(name string, image *Image) {
+	if lc == nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.images[name] = image
+}
@@ -3,6 +3,7 @@ package ecloud
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"time"
 
@@ -29,15 +30,16 @@ const (
 
 // Network represents a network in Elemento Cloud.
 type Network struct {
-	ID         string
-	Name       string
-	Created    time.Time
-	IPRange    *net.IPNet
-	Subnets    []NetworkSubnet
-	Routes     string
-	Servers    []*Server
-	Protection bool
-	Labels     map[string]string
+	ID             string
+	Name           string
+	LibvirtNetwork string // Name of the network in libvirt, which servers may refer to
+	Created        time.Time
+	IPRange        *net.IPNet
+	Subnets        []NetworkSubnet
+	Routes         string
+	Servers        []*Server
+	Protection     bool
+	Labels         map[string]string
 }
 
 // NetworkSubnet represents a subnet of a network in the Elemento Cloud.
@@ -60,6 +62,7 @@ func (c *NetworkClient) GetByID(ctx context.Context, uuid string) (*Network, *sc
 	body.NetworkID = uuid
 	resp, err := c.client.GetNetworkByID(body)
 	if err != nil {
+		err = notFoundError(err, fmt.Sprintf("network %s not found", uuid))
 		if IsError(err, ErrorCodeNotFound) {
 			return nil, resp, nil
 		}
@@ -89,7 +92,12 @@ type NetworkListOpts struct {
 
 // List returns a list of networks.
 func (c *NetworkClient) List(ctx context.Context, opts NetworkListOpts) ([]*Network, *schema.ListNetworkResponse, error) {
-	resp, err := c.client.ListNetwork()
+	selector, err := ParseLabelSelector(opts.LabelSelector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.client.ListNetworkWithOpts(opts.ListOpts)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -98,6 +106,9 @@ func (c *NetworkClient) List(ctx context.Context, opts NetworkListOpts) ([]*Netw
 		if opts.Name != "" && s.Name != opts.Name {
 			continue
 		}
+		if !selector.Matches(s.Labels) {
+			continue
+		}
 		Networks = append(Networks, NetworkFromSchema(s))
 	}
 	return Networks, resp, nil
@@ -250,18 +261,7 @@ func (c *NetworkClient) Create(ctx context.Context, opts NetworkCreateOpts) (*Ne
 
 // NetworkServerFromSchema converts a schema.Server to a Server compatible with kOps.
 func NetworkServerFromSchema(s schema.Server) *Server {
-	return &Server{
-		ID:           s.UniqueID,
-		Name:         s.Name,
-		Status:       ServerStatus(s.Status),
-		Created:      s.Created,
-		PublicNet:    ServerPublicNet{},
-		ServerType:   &ServerType{},
-		Datacenter:   Datacenter{},
-		BackupWindow: "",
-		Labels:       s.Labels,
-		Volumes:      []*schema.StorageVolume{},
-	}
+	return ServerFromSchema(s)
 }
 
 // NetworkFromSchema converts a schema.Network to a Network compatible with kOps.
@@ -291,15 +291,16 @@ func NetworkFromSchema(s schema.Network) *Network {
 	}
 
 	return &Network{
-		ID:         s.NetworkID,
-		Name:       s.Name,
-		Created:    time.Now(),
-		IPRange:    ipRange,
-		Subnets:    nil,
-		Routes:     routesStr,
-		Servers:    nil,
-		Protection: s.Private,
-		Labels:     nil,
+		ID:             s.NetworkID,
+		Name:           s.Name,
+		LibvirtNetwork: s.LibvirtNetwork,
+		Created:        time.Now(),
+		IPRange:        ipRange,
+		Subnets:        nil,
+		Routes:         routesStr,
+		Servers:        nil,
+		Protection:     s.Private,
+		Labels:         s.Labels,
 	}
 }
 
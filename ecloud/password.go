@@ -0,0 +1,199 @@
+package ecloud
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// redacted replaces the value of a SecretString when printed.
+const redacted = "[REDACTED]"
+
+// SecretString is a string that redacts itself when printed or marshalled,
+// so that it does not leak into logs. Use Reveal to read its value.
+type SecretString string
+
+// Reveal returns the secret value.
+func (s SecretString) Reveal() string {
+	return string(s)
+}
+
+// String returns the redacted value, or an empty string if there is no secret.
+func (s SecretString) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Format redacts the secret for every verb, including %#v and %q.
+func (s SecretString) Format(f fmt.State, verb rune) {
+	if verb == 'q' {
+		fmt.Fprint(f, strconv.Quote(s.String()))
+		return
+	}
+	fmt.Fprint(f, s.String())
+}
+
+// MarshalJSON marshals the redacted value.
+func (s SecretString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// rootPasswordLength is the length of the generated root passwords.
+const rootPasswordLength = 24
+
+const passwordAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// newRootPassword returns a random password and its SHA-512 crypt hash.
+func newRootPassword() (SecretString, string, error) {
+	password, err := randomString(passwordAlphabet, rootPasswordLength)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate root password: %w", err)
+	}
+	hash, err := hashRootPassword(SecretString(password))
+	if err != nil {
+		return "", "", err
+	}
+	return SecretString(password), hash, nil
+}
+
+// hashRootPassword returns the SHA-512 crypt hash of password with a random salt.
+func hashRootPassword(password SecretString) (string, error) {
+	salt, err := randomString(cryptAlphabet, 16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate root password salt: %w", err)
+	}
+	return sha512Crypt(password.Reveal(), salt, sha512CryptRounds), nil
+}
+
+// randomString returns a random string of length characters from alphabet.
+func randomString(alphabet string, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// ------------------------------ SHA-512 CRYPT -------------------------------
+
+// cryptAlphabet is the base64 alphabet of crypt(3).
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha512CryptRounds is the default number of rounds, omitted from the hash.
+const sha512CryptRounds = 5000
+
+// sha512CryptOrder is the order in which the digest bytes are encoded, by groups of 3.
+var sha512CryptOrder = [...]int{
+	0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48,
+	28, 49, 7, 50, 8, 29, 9, 30, 51, 31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13,
+	56, 14, 35, 15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19, 62, 20, 41,
+}
+
+// sha512Crypt hashes password with the SHA-512 based crypt(3) scheme ("$6$"),
+// as understood by chpasswd -e. Only the first 16 characters of salt are used.
+func sha512Crypt(password string, salt string, rounds int) string {
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	p, s := []byte(password), []byte(salt)
+
+	// Digest B: password, salt, password
+	b := sha512.New()
+	b.Write(p)
+	b.Write(s)
+	b.Write(p)
+	digestB := b.Sum(nil)
+
+	// Digest A
+	a := sha512.New()
+	a.Write(p)
+	a.Write(s)
+	for n := len(p); n > 0; n -= 64 {
+		a.Write(digestB[:min(n, 64)])
+	}
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(p)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	// Sequence P: digest of the password repeated, stretched to its length
+	dp := sha512.New()
+	for range p {
+		dp.Write(p)
+	}
+	seqP := repeatBytes(dp.Sum(nil), len(p))
+
+	// Sequence S: digest of the salt repeated 16+A[0] times, cut to its length
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(s)
+	}
+	seqS := repeatBytes(ds.Sum(nil), len(s))
+
+	digest := digestA
+	for i := 0; i < rounds; i++ {
+		c := sha512.New()
+		if i%2 != 0 {
+			c.Write(seqP)
+		} else {
+			c.Write(digest)
+		}
+		if i%3 != 0 {
+			c.Write(seqS)
+		}
+		if i%7 != 0 {
+			c.Write(seqP)
+		}
+		if i%2 != 0 {
+			c.Write(digest)
+		} else {
+			c.Write(seqP)
+		}
+		digest = c.Sum(nil)
+	}
+
+	out := []byte("$6$")
+	if rounds != sha512CryptRounds {
+		out = append(out, "rounds="+strconv.Itoa(rounds)+"$"...)
+	}
+	out = append(out, salt...)
+	out = append(out, '$')
+	for i := 0; i < len(sha512CryptOrder); i += 3 {
+		out = appendCrypt64(out, digest[sha512CryptOrder[i]], digest[sha512CryptOrder[i+1]], digest[sha512CryptOrder[i+2]], 4)
+	}
+	out = appendCrypt64(out, 0, 0, digest[63], 2)
+	return string(out)
+}
+
+// appendCrypt64 appends n characters encoding the 24 bits b2, b1, b0.
+func appendCrypt64(out []byte, b2, b1, b0 byte, n int) []byte {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		out = append(out, cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+	return out
+}
+
+// repeatBytes repeats b up to length bytes.
+func repeatBytes(b []byte, length int) []byte {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		out = append(out, b[:min(len(b), length-len(out))]...)
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package ecloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// Test vectors from the SHA-crypt specification
+	tests := []struct {
+		password string
+		salt     string
+		rounds   int
+		expected string
+	}{
+		{
+			password: "Hello world!",
+			salt:     "saltstring",
+			rounds:   5000,
+			expected: "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{
+			password: "Hello world!",
+			salt:     "saltstringsaltstring",
+			rounds:   10000,
+			expected: "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		{
+			password: "we have a short salt string but not a short password",
+			salt:     "short",
+			rounds:   77777,
+			expected: "$6$rounds=77777$short$WuQyW2YR.hBNpjjRhpYD/ifIw05xdfeEyQoMxIXbkvr0gge1a1x3yRULJ5CCaUeOxFmtlcGZelFl5CxtgfiAc0",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := sha512Crypt(tt.password, tt.salt, tt.rounds); got != tt.expected {
+			t.Errorf("sha512Crypt(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.rounds, got, tt.expected)
+		}
+	}
+}
+
+func TestNewRootPassword(t *testing.T) {
+	password, hash, err := newRootPassword()
+	if err != nil {
+		t.Fatalf("newRootPassword returned error: %v", err)
+	}
+	if len(password.Reveal()) != rootPasswordLength {
+		t.Errorf("expected a %d characters password, got %d", rootPasswordLength, len(password.Reveal()))
+	}
+
+	// The hash must verify the password with its own salt
+	salt := strings.Split(hash, "$")[2]
+	if sha512Crypt(password.Reveal(), salt, sha512CryptRounds) != hash {
+		t.Errorf("hash %s does not match the password", hash)
+	}
+
+	other, _, _ := newRootPassword()
+	if other == password {
+		t.Errorf("expected a different password at each call")
+	}
+}
+
+func TestSecretStringRedacted(t *testing.T) {
+	secret := SecretString("hunter2")
+	result := ServerCreateResult{RootPassword: secret}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q"} {
+		if out := fmt.Sprintf(format, result); strings.Contains(out, "hunter2") {
+			t.Errorf("%s leaked the secret: %s", format, out)
+		}
+	}
+	if out, _ := json.Marshal(result); strings.Contains(string(out), "hunter2") {
+		t.Errorf("JSON leaked the secret: %s", out)
+	}
+	if secret.Reveal() != "hunter2" {
+		t.Errorf("Reveal() = %q", secret.Reveal())
+	}
+	if SecretString("").String() != "" {
+		t.Errorf("expected an empty secret to print as empty")
+	}
+}
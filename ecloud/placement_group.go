@@ -0,0 +1,198 @@
+package ecloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// PlacementGroupType specifies the placement policy of a placement group.
+type PlacementGroupType string
+
+const (
+	// PlacementGroupTypeSpread places every member on a different provider/region.
+	PlacementGroupTypeSpread PlacementGroupType = "spread"
+)
+
+// PlacementGroup represents a group of servers placed according to a policy.
+// The daemons have no notion of placement groups: a group is stored in the
+// labels of its members, and exists as long as it has members.
+type PlacementGroup struct {
+	Name    string
+	Type    PlacementGroupType
+	Servers []string // IDs of the member servers
+}
+
+// PlacementGroupClient is a client for the placement groups.
+type PlacementGroupClient struct {
+	client *Client
+
+	// reserved holds the placements (by group name) of the creations in
+	// progress, which are not listed as members yet
+	mu       sync.Mutex
+	reserved map[string]map[string]bool
+}
+
+// GetByName retrieves a placement group by its name. If the group has no
+// members, nil is returned.
+func (c *PlacementGroupClient) GetByName(ctx context.Context, name string) (*PlacementGroup, *Response, error) {
+	if name == "" {
+		return nil, nil, nil
+	}
+	groups, _, err := c.list(ctx, LabelPlacementGroup+"="+name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(groups) == 0 {
+		return nil, &Response{}, nil
+	}
+	return groups[0], &Response{}, nil
+}
+
+// All returns all placement groups with at least one member.
+func (c *PlacementGroupClient) All(ctx context.Context) ([]*PlacementGroup, error) {
+	groups, _, err := c.list(ctx, LabelPlacementGroup)
+	return groups, err
+}
+
+func (c *PlacementGroupClient) list(ctx context.Context, labelSelector string) ([]*PlacementGroup, *Response, error) {
+	servers, _, err := c.client.Server.List(ctx, ServerListOpts{ListOpts: ListOpts{LabelSelector: labelSelector}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups := []*PlacementGroup{}
+	byName := map[string]*PlacementGroup{}
+	for _, server := range servers {
+		name := server.Labels[LabelPlacementGroup]
+		group, ok := byName[name]
+		if !ok {
+			group = &PlacementGroup{Name: name, Type: PlacementGroupType(server.Labels[LabelPlacementGroupType])}
+			if group.Type == "" {
+				group.Type = PlacementGroupTypeSpread
+			}
+			byName[name] = group
+			groups = append(groups, group)
+		}
+		group.Servers = append(group.Servers, server.ID)
+	}
+	return groups, &Response{}, nil
+}
+
+// PlacementGroupCreateOpts specifies options for creating a placement group.
+type PlacementGroupCreateOpts struct {
+	Name string
+	Type PlacementGroupType
+}
+
+// Validate checks if options are valid.
+func (o PlacementGroupCreateOpts) Validate() error {
+	if o.Name == "" {
+		return errors.New("missing name")
+	}
+	if o.Type != PlacementGroupTypeSpread {
+		return fmt.Errorf("unsupported placement group type %q", o.Type)
+	}
+	return nil
+}
+
+// Create returns a new placement group, to be passed to ServerCreateOpts. The
+// group is stored when its first member is created; if it already has members,
+// the existing group is returned.
+func (c *PlacementGroupClient) Create(ctx context.Context, opts PlacementGroupCreateOpts) (*PlacementGroup, *Response, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	existing, _, err := c.GetByName(ctx, opts.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing != nil {
+		if existing.Type != opts.Type {
+			return nil, nil, Error{
+				Code:    ErrorCodeUniquenessError,
+				Message: fmt.Sprintf("placement group %q already exists with type %s", opts.Name, existing.Type),
+			}
+		}
+		return existing, &Response{}, nil
+	}
+	return &PlacementGroup{Name: opts.Name, Type: opts.Type}, &Response{}, nil
+}
+
+// placementKey identifies where a server is allocated.
+func placementKey(provider, region string) string {
+	return provider + "/" + region
+}
+
+// placementLabels returns the labels recording a server's group and placement.
+func placementLabels(group *PlacementGroup, placement schema.ProviderInfo) map[string]string {
+	return map[string]string{
+		LabelPlacementGroup:     group.Name,
+		LabelPlacementGroupType: string(group.Type),
+		LabelProvider:           placement.Provider,
+		LabelRegion:             placement.Region,
+	}
+}
+
+// reserve picks, among the candidates returned by canallocate, a placement not
+// used by any member of group and reserves it until release is called.
+func (c *PlacementGroupClient) reserve(ctx context.Context, group *PlacementGroup, candidates []schema.ProviderInfo) (placement schema.ProviderInfo, release func(), err error) {
+	members, _, err := c.client.Server.List(ctx, ServerListOpts{
+		ListOpts: ListOpts{LabelSelector: LabelPlacementGroup + "=" + group.Name},
+	})
+	if err != nil {
+		return schema.ProviderInfo{}, nil, err
+	}
+	used := map[string]bool{}
+	for _, member := range members {
+		used[placementKey(member.Labels[LabelProvider], member.Labels[LabelRegion])] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.reserved[group.Name] {
+		used[key] = true
+	}
+
+	placement, ok := pickSpreadPlacement(candidates, used)
+	if !ok {
+		return schema.ProviderInfo{}, nil, Error{
+			Code: ErrorCodePlacementError,
+			Message: fmt.Sprintf("no provider/region left for placement group %q: %d candidates, %d already used",
+				group.Name, len(candidates), len(used)),
+		}
+	}
+
+	key := placementKey(placement.Provider, placement.Region)
+	if c.reserved == nil {
+		c.reserved = map[string]map[string]bool{}
+	}
+	if c.reserved[group.Name] == nil {
+		c.reserved[group.Name] = map[string]bool{}
+	}
+	c.reserved[group.Name][key] = true
+
+	release = func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.reserved[group.Name], key)
+		if len(c.reserved[group.Name]) == 0 {
+			delete(c.reserved, group.Name)
+		}
+	}
+	return placement, release, nil
+}
+
+// pickSpreadPlacement returns the first candidate whose provider/region is not used.
+func pickSpreadPlacement(candidates []schema.ProviderInfo, used map[string]bool) (schema.ProviderInfo, bool) {
+	for _, candidate := range candidates {
+		if !used[placementKey(candidate.Provider, candidate.Region)] {
+			return candidate, true
+		}
+	}
+	return schema.ProviderInfo{}, false
+}
@@ -0,0 +1,72 @@
+package ecloud
+
+import (
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestPickSpreadPlacement(t *testing.T) {
+	candidates := []schema.ProviderInfo{
+		{Provider: "ovh", Region: "eu-west"},
+		{Provider: "aruba", Region: "eu-south"},
+		{Provider: "aruba", Region: "eu-central"},
+	}
+
+	tests := []struct {
+		name     string
+		used     map[string]bool
+		expected string
+		ok       bool
+	}{
+		{
+			name:     "No member yet",
+			used:     map[string]bool{},
+			expected: "ovh/eu-west",
+			ok:       true,
+		},
+		{
+			name:     "Skips used placements",
+			used:     map[string]bool{"ovh/eu-west": true, "aruba/eu-south": true},
+			expected: "aruba/eu-central",
+			ok:       true,
+		},
+		{
+			name: "Every placement used",
+			used: map[string]bool{"ovh/eu-west": true, "aruba/eu-south": true, "aruba/eu-central": true},
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placement, ok := pickSpreadPlacement(candidates, tt.used)
+			if ok != tt.ok {
+				t.Fatalf("pickSpreadPlacement() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && placementKey(placement.Provider, placement.Region) != tt.expected {
+				t.Errorf("pickSpreadPlacement() = %s/%s, want %s", placement.Provider, placement.Region, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPlacementGroupCreateOptsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    PlacementGroupCreateOpts
+		wantErr bool
+	}{
+		{name: "Valid", opts: PlacementGroupCreateOpts{Name: "masters", Type: PlacementGroupTypeSpread}},
+		{name: "Missing name", opts: PlacementGroupCreateOpts{Type: PlacementGroupTypeSpread}, wantErr: true},
+		{name: "Unsupported type", opts: PlacementGroupCreateOpts{Name: "masters", Type: "pack"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
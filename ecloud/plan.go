@@ -0,0 +1,138 @@
+package ecloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// PlannedRequest is a request to the daemons that Create would make.
+type PlannedRequest struct {
+	Method string
+	Port   string
+	Path   string
+	Body   interface{} // Request body, IDs not known yet are replaced by "<name>" of the resource
+}
+
+// ServerCreatePlan describes what Create would do with the same options.
+type ServerCreatePlan struct {
+	Requests  []PlannedRequest // In the order Create makes them
+	CloudInit string           // Rendered user-data of the cloud-init volume
+	Provider  string           // Provider chosen for the server, empty if left to the daemons
+	Region    string
+	Price     schema.Price // Estimated cost of the server, as quoted by canallocate
+}
+
+// Plan performs the validation, resolution and allocation checks of Create and
+// returns the requests Create would make, without creating anything. Resources
+// an IdempotencyKey would adopt are planned as new.
+func (c *ServerClient) Plan(ctx context.Context, opts ServerCreateOpts) (*ServerCreatePlan, *Response, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	prep, err := c.prepareCreate(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer prep.release()
+	reqBody := prep.reqBody
+
+	plan := &ServerCreatePlan{
+		Provider: reqBody.Provider,
+		Region:   reqBody.Region,
+		Price:    estimatePrice(prep.canAllocate.Mesos, reqBody.Provider, reqBody.Region),
+	}
+
+	// Boot volume
+	layout := opts.diskLayout()
+	bootOpts := bootVolumeOpts(opts.Name, prep.image, layout.boot, opts.IdempotencyKey)
+	if err := c.planVolume(plan, bootOpts); err != nil {
+		return nil, nil, err
+	}
+	reqBody.Volumes = append(reqBody.Volumes, map[string]string{"vid": plannedID(bootOpts.Name)})
+
+	// Cloud-init volume, fed with the meta-data once created
+	cloudinit := cloudInitOpts(opts.Name, opts.IdempotencyKey)
+	sshKeys := sshPublicKeys(opts.SSHKeys)
+	cloudInitCfg := cloudInitConfig{Hostname: opts.Name, UserData: opts.UserData, Layout: layout, SSHKeys: sshKeys}
+	if len(sshKeys) == 0 {
+		cloudInitCfg.PasswordHash = plannedID("root password hash")
+	}
+	plan.CloudInit = renderCloudInit(cloudInitCfg)
+	plan.Requests = append(plan.Requests,
+		PlannedRequest{
+			Method: "POST",
+			Port:   "27777",
+			Path:   "/api/v1.0/client/volume/cloudinit/metadata/{payload}",
+			Body:   cloudinit.request(),
+		},
+		PlannedRequest{
+			Method: "POST",
+			Port:   "27777",
+			Path:   "/api/v1.0/client/volume/cloudinit/metadata/{payload}",
+			Body:   schema.FeedFileIntoCloudInitStorageRequest{VolumeID: plannedID(cloudinit.volumeName())},
+		},
+	)
+	reqBody.Volumes = append(reqBody.Volumes, map[string]string{"vid": plannedID(cloudinit.volumeName())})
+
+	// Data volumes
+	for _, dataOpts := range layout.dataVolumes(opts.Name, opts.IdempotencyKey) {
+		if err := c.planVolume(plan, dataOpts); err != nil {
+			return nil, nil, err
+		}
+		reqBody.Volumes = append(reqBody.Volumes, map[string]string{"vid": plannedID(dataOpts.Name)})
+	}
+
+	// VM registration
+	plan.Requests = append(plan.Requests, PlannedRequest{
+		Method: "POST",
+		Port:   "17777",
+		Path:   "/api/v1.0/client/vm/register",
+		Body:   reqBody,
+	})
+
+	return plan, &Response{}, nil
+}
+
+// planVolume checks that the volume described by opts can be created and adds
+// its creation to plan.
+func (c *ServerClient) planVolume(plan *ServerCreatePlan, opts VolumeCreateOpts) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if _, err := c.client.CanCreateStorage(schema.CanCreateStorageRequest{Size: opts.Size}); err != nil {
+		return fmt.Errorf("volume %s cannot be created: %w", opts.Name, err)
+	}
+
+	request := PlannedRequest{Method: "POST", Port: "27777"}
+	if opts.Url == "" {
+		request.Path = "/api/v1.0/client/volume/create"
+		request.Body = opts.storageRequest()
+	} else {
+		request.Path = "/api/v1.0/client/volume/cloudinit/create"
+		request.Body = opts.imageRequest()
+	}
+	plan.Requests = append(plan.Requests, request)
+	return nil
+}
+
+// plannedID returns the placeholder of the ID of a resource not created yet.
+func plannedID(name string) string {
+	return "<" + name + ">"
+}
+
+// estimatePrice returns the price quoted for the provider and region, or the
+// first quote if the daemons choose the provider.
+func estimatePrice(quotes []schema.ProviderInfo, provider, region string) schema.Price {
+	for _, quote := range quotes {
+		if quote.Provider == provider && quote.Region == region {
+			return quote.Price
+		}
+	}
+	if len(quotes) > 0 {
+		return quotes[0].Price
+	}
+	return schema.Price{}
+}
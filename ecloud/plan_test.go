@@ -0,0 +1,34 @@
+package ecloud
+
+import (
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestEstimatePrice(t *testing.T) {
+	quotes := []schema.ProviderInfo{
+		{Provider: "ovh", Region: "eu-west", Price: schema.Price{Hour: 0.05, Unit: "EUR"}},
+		{Provider: "aruba", Region: "eu-south", Price: schema.Price{Hour: 0.04, Unit: "EUR"}},
+	}
+
+	tests := []struct {
+		name     string
+		quotes   []schema.ProviderInfo
+		provider string
+		region   string
+		expected float64
+	}{
+		{name: "Chosen provider", quotes: quotes, provider: "aruba", region: "eu-south", expected: 0.04},
+		{name: "Provider left to the daemons", quotes: quotes, expected: 0.05},
+		{name: "No quote", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if price := estimatePrice(tt.quotes, tt.provider, tt.region); price.Hour != tt.expected {
+				t.Errorf("estimatePrice() = %v, want %v", price.Hour, tt.expected)
+			}
+		})
+	}
+}
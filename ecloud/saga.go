@@ -0,0 +1,69 @@
+package ecloud
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// sagaStep is a resource created during a multi-step operation together with
+// the action that removes it again.
+type sagaStep struct {
+	kind string
+	id   string
+	undo func() error
+}
+
+// createSaga records every resource created by a multi-step operation (e.g.
+// ServerClient.Create) so that a later failure can remove them again.
+// A nil *createSaga is valid and records nothing.
+type createSaga struct {
+	steps []sagaStep
+}
+
+// track records a created resource and the action that deletes it.
+func (s *createSaga) track(kind, id string, undo func() error) {
+	if s == nil {
+		return
+	}
+	s.steps = append(s.steps, sagaStep{kind: kind, id: id, undo: undo})
+}
+
+// trackVolume records a created storage volume.
+func (s *createSaga) trackVolume(client *Client, volumeID string) {
+	s.track("volume", volumeID, func() error {
+		_, err := client.DeleteStorage(schema.DeleteStorageRequest{VolumeID: volumeID})
+		return err
+	})
+}
+
+// rollback deletes the recorded resources in reverse creation order and
+// returns a *RollbackError wrapping cause and every cleanup failure.
+func (s *createSaga) rollback(cause error) error {
+	if s == nil || len(s.steps) == 0 {
+		return cause
+	}
+	rbErr := &RollbackError{Err: cause}
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if err := step.undo(); err != nil {
+			rbErr.CleanupErrors = append(rbErr.CleanupErrors, fmt.Errorf("failed to delete %s %s: %w", step.kind, step.id, err))
+		}
+	}
+	s.steps = nil
+	return rbErr
+}
+
+// sleepContext waits for the given duration or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package ecloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateSagaRollback(t *testing.T) {
+	var deleted []string
+	undo := func(id string, err error) func() error {
+		return func() error {
+			deleted = append(deleted, id)
+			return err
+		}
+	}
+
+	cleanupErr := errors.New("storage daemon unavailable")
+	saga := &createSaga{}
+	saga.track("volume", "boot", undo("boot", nil))
+	saga.track("volume", "cloudinit", undo("cloudinit", cleanupErr))
+	saga.track("volume", "data", undo("data", nil))
+
+	cause := errors.New("failed to create compute instance")
+	err := saga.rollback(cause)
+
+	expected := []string{"data", "cloudinit", "boot"}
+	if len(deleted) != len(expected) {
+		t.Fatalf("expected %d deletions, got %d", len(expected), len(deleted))
+	}
+	for i, id := range expected {
+		if deleted[i] != id {
+			t.Errorf("deletion %d: expected %q, got %q", i, id, deleted[i])
+		}
+	}
+
+	var rbErr *RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("expected *RollbackError, got %T", err)
+	}
+	if len(rbErr.CleanupErrors) != 1 {
+		t.Errorf("expected 1 cleanup error, got %d", len(rbErr.CleanupErrors))
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expected error to wrap the original failure")
+	}
+	if !errors.Is(err, cleanupErr) {
+		t.Errorf("expected error to wrap the cleanup failure")
+	}
+}
+
+func TestCreateSagaRollbackEmpty(t *testing.T) {
+	cause := errors.New("invalid options")
+
+	var nilSaga *createSaga
+	nilSaga.track("volume", "boot", func() error { return nil })
+	if err := nilSaga.rollback(cause); err != cause {
+		t.Errorf("expected nil saga to return the cause unchanged, got %v", err)
+	}
+
+	if err := (&createSaga{}).rollback(cause); err != cause {
+		t.Errorf("expected empty saga to return the cause unchanged, got %v", err)
+	}
+}
+
+func TestSleepContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := sleepContext(ctx, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("sleepContext did not return promptly on cancellation")
+	}
+}
@@ -1,6 +1,13 @@
 package ecloud
 
 import (
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
 )
 
@@ -15,26 +22,162 @@ func ServerPublicNetFromSchema(nc schema.NetworkConfig) ServerPublicNet {
 	}
 }
 
+// ServerPrivateNetFromSchema converts a schema.NetworkConfig to the private networks of a server.
+// No network is returned if the VM has no network device.
+func ServerPrivateNetFromSchema(nc schema.NetworkConfig) []ServerPrivateNet {
+	if nc.Source == "" && nc.MAC == "" {
+		return nil
+	}
+	privateNet := ServerPrivateNet{
+		Network:    &Network{Name: nc.Source},
+		MACAddress: nc.MAC,
+		Interface:  nc.Interface,
+	}
+	if nc.IPv4 != nil {
+		privateNet.IP = parseIP(*nc.IPv4)
+	}
+	return []ServerPrivateNet{privateNet}
+}
+
+// ServerTypeFromSchema reconstructs the ServerType of a VM from its registration request.
+// RamSize is expected in MB, as returned by GetCompute.
+func ServerTypeFromSchema(rc schema.RequestConfig) *ServerType {
+	ramsize := int(rc.RamSize)
+	return &ServerType{
+		Name:          serverSizeName(rc.Slots, ramsize),
+		Cores:         rc.Slots,
+		Memory:        float32(rc.RamSize / 1024), // Convert MB to GB
+		Architecture:  Architecture(strings.ToUpper(rc.Arch)),
+		Overprovision: rc.Overprovision,
+		AllowSMT:      rc.AllowSMT,
+		ReqECC:        rc.ReqECC,
+		Flags:         rc.Flags,
+	}
+}
+
+// DatacenterFromServerURL returns the Datacenter of the host serving a VM.
+func DatacenterFromServerURL(serverURL string) Datacenter {
+	dc := Datacenter{Location: serverURL}
+	if u, err := url.Parse(serverURL); err == nil && u.Hostname() != "" {
+		dc.Name = u.Hostname()
+	}
+	return dc
+}
+
 // ServerFromSchema converts a schema.Server to a Server structure compatible with kOps.
 func ServerFromSchema(s schema.Server) *Server {
 	server := &Server{
-		ID:        s.UniqueID,
-		Name:      s.Name,
-		Status:    ServerStatus(s.Status),
-		Created:   s.Created,
-		PublicNet: ServerPublicNetFromSchema(s.NetworkConfig),
-		Labels:    s.Labels,
+		ID:         s.UniqueID,
+		Name:       s.Name,
+		Status:     ServerStatusFromString(s.Status),
+		Created:    s.Created,
+		PublicNet:  ServerPublicNetFromSchema(s.NetworkConfig),
+		PrivateNet: ServerPrivateNetFromSchema(s.NetworkConfig),
+		ServerType: ServerTypeFromSchema(s.ReqJSON),
+		Datacenter: DatacenterFromServerURL(s.ServerURL),
+		Labels:     s.Labels,
+		IsGateway:  s.IsGateway,
+		ServerURL:  s.ServerURL,
+		OSFamily:   s.ReqJSON.OSFamily,
+		OSFlavour:  s.ReqJSON.OSFlavour,
+	}
+	if server.Created.IsZero() {
+		server.Created = s.CreationDate
+	}
+	if server.Name == "" {
+		server.Name = s.ReqJSON.VMName
 	}
 
-	// Convert volumes // TODO: correct?
-	for _, vol := range s.Volumes {
-		server.Volumes = append(server.Volumes, &schema.StorageVolume{
-			VolumeID:   vol.VolumeID,
-			Name: 		vol.Name,
-		})
+	// Volumes are reported at top level, older daemons only report them in the request
+	volumes := s.Volumes
+	if len(volumes) == 0 {
+		volumes = s.ReqJSON.Volumes
 	}
+	for i := range volumes {
+		vol := volumes[i]
+		server.Volumes = append(server.Volumes, &vol)
 
-	// Add optional fields here
+		// The data disk is the first volume not created for booting the VM
+		if server.ServerType.Disk == 0 && !isSystemVolume(server.Name, vol) {
+			server.ServerType.Disk = int(vol.Size)
+		}
+	}
 
 	return server
 }
+
+// isSystemVolume reports whether vol is the boot or cloud-init volume created for the server.
+func isSystemVolume(serverName string, vol schema.StorageVolume) bool {
+	return vol.Cloudinit || vol.Name == serverName+"-boot" || vol.Name == serverName+"-cloudinit"
+}
+
+// parseIP parses an IP address, optionally given in CIDR notation.
+func parseIP(s string) net.IP {
+	if ip, _, err := net.ParseCIDR(s); err == nil {
+		return ip
+	}
+	return net.ParseIP(s)
+}
+
+// VolumeFromSchema converts a schema.StorageVolume to a Volume.
+func VolumeFromSchema(s schema.StorageVolume) *Volume {
+	volume := &Volume{
+		ID:          s.VolumeID,
+		Name:        s.Name,
+		Status:      VolumeStatusAvailable,
+		Size:        ByteSize(s.Size * float64(Gigabyte)),
+		SizeOnDisk:  ByteSize(s.SizeOnDisk),
+		Format:      s.Format,
+		Bus:         DiskBus(s.Bus),
+		Alg:         s.Alg,
+		Bootable:    s.Bootable,
+		Readonly:    s.Readonly,
+		Shareable:   s.Shareable,
+		Private:     s.Private,
+		Clonable:    s.Clonable,
+		CloudInit:   s.Cloudinit,
+		Exported:    s.Exported,
+		Own:         s.Own,
+		CreatorID:   s.CreatorID,
+		LastUpdated: parseTimestamp(s.LastUpdated),
+		Datacenter:  DatacenterFromServerURL(s.ServerUrl),
+		ServerURL:   s.ServerUrl,
+		Labels:      s.Labels,
+	}
+	if isAttached(s) {
+		volume.Status = VolumeStatusAttached
+	}
+	for _, id := range s.Servers {
+		volume.Servers = append(volume.Servers, &Server{ID: id})
+	}
+	return volume
+}
+
+// isAttached reports whether vol is attached to at least one server.
+func isAttached(vol schema.StorageVolume) bool {
+	return vol.Nservers > 0 || len(vol.Servers) > 0
+}
+
+// timestampLayouts are the layouts of the timestamps reported by the daemons.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02 15:04:05",
+}
+
+// parseTimestamp parses a timestamp reported by the daemons, either formatted
+// or in seconds since the epoch. The zero time is returned if it is invalid.
+func parseTimestamp(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+	}
+	return time.Time{}
+}
@@ -6,16 +6,17 @@ import (
 
 // Network represents a network in the API response
 type Network struct {
-	CreatorID      string    `json:"creator_uid"`
-	DeviceName     string    `json:"device_name"`
-	IP             NetworkIP `json:"ip"`
-	LibvirtNetwork string    `json:"libvirt_network"`
-	Name           string    `json:"network_name"`
-	NetworkID      string    `json:"network_uid"`
-	Private        bool      `json:"private"`
-	Routes         []Route   `json:"routes,omitempty"`
-	ServerUrl      string    `json:"serverurl"`
-	Type           string    `json:"type"`
+	CreatorID      string            `json:"creator_uid"`
+	DeviceName     string            `json:"device_name"`
+	IP             NetworkIP         `json:"ip"`
+	LibvirtNetwork string            `json:"libvirt_network"`
+	Name           string            `json:"network_name"`
+	NetworkID      string            `json:"network_uid"`
+	Private        bool              `json:"private"`
+	Routes         []Route           `json:"routes,omitempty"`
+	ServerUrl      string            `json:"serverurl"`
+	Type           string            `json:"type"`
+	Labels         map[string]string `json:"labels,omitempty"`
 }
 
 type Route struct {
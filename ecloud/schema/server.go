@@ -63,10 +63,13 @@ type CreateComputeRequest struct {
 	Volumes       []map[string]string `json:"volumes"`
 	HasNetwork    bool                `json:"has_network"`
 	Networks      []map[string]string `json:"networks"`
+	Labels        map[string]string   `json:"labels,omitempty"`
+	Provider      string              `json:"provider,omitempty"` // Provider picked from the canallocate results
+	Region        string              `json:"region,omitempty"`
+	IsGateway     bool                `json:"is_gateway,omitempty"`
 }
 // kOps required ?
 // UserData   string             `json:"user_data,omitempty"`
-// Labels     *map[string]string `json:"labels,omitempty"`
 // SSHKeys    []int              `json:"ssh_keys,omitempty"`
 // Datacenter string             `json:"datacenter,omitempty"`
 // Networks   []int              `json:"networks,omitempty"`
@@ -124,6 +127,7 @@ type NetworkConfig struct {
 type NetworkDisplay struct {
 	Protocol string `json:"protocol"`
 	Port     int    `json:"port"`
+	Password string `json:"passwd,omitempty"` // Optional display password
 }
 
 // -------- COMPUTE TEMPLATES --------
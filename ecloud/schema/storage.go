@@ -25,6 +25,7 @@ type StorageVolume struct {
 	Own       bool     `json:"own"`
 	Nservers  int      `json:"nservers"`
 	Servers   []string `json:"servers"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 // -------- HEALTH CHECK --------
@@ -47,6 +48,7 @@ type CreateStorageRequest struct {
 	Readonly  bool   `json:"readonly"`
 	Shareable bool   `json:"shareable"`
 	Private   bool   `json:"private"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 type CreateStorageResponse struct{
@@ -74,6 +76,8 @@ type CreateStorageImageRequest struct {
 	Bus			string	`json:"bus"`
 	Size		int		`json:"size"`
 	Url			string	`json:"url"`
+	Checksum	string	`json:"checksum,omitempty"` // Expected checksum of the image at Url, verified by the daemon
+	Labels		map[string]string	`json:"labels,omitempty"`
 }
 
 type CreateStorageImageResponse struct{
@@ -85,6 +89,7 @@ type CreateStorageImageResponse struct{
 	Bus			string	`json:"bus"`
 	Size		int		`json:"size"`
 	Url			string	`json:"url"`
+	Checksum	string	`json:"checksum,omitempty"` // Checksum of the downloaded image, "<algorithm>:<hex digest>"
 	VolumeID	string	`json:"vid"`		
 }
 
@@ -96,6 +101,7 @@ type CreateStorageCloudInitRequest struct {
 	Clonable		bool 	`json:"clonable"`
 	Alg				string	`json:"alg"`
 	ExpectedFiles	int		`json:"expectedFiles"`
+	Labels			map[string]string	`json:"labels,omitempty"`
 }
 
 type CreateStorageCloudInitResponse struct {
@@ -124,3 +130,62 @@ type DeleteStorageRequest struct {
 }
 
 type DeleteStorageResponse struct{}
+
+// -------- RESIZE STORAGE --------
+type ResizeStorageRequest struct {
+	VolumeID string `json:"volume_id"`
+	Size     int    `json:"size"` // GB
+}
+
+type ResizeStorageResponse struct{}
+
+// -------- UPLOAD STORAGE IMAGE --------
+// The image is sent in chunks, as multipart files like the cloud-init files:
+// the first chunk creates the volume, the following ones feed it.
+type CreateStorageUploadRequest struct {
+	Name           string            `json:"name"`
+	Size           int               `json:"size"` // GB
+	Format         string            `json:"format"`
+	Bus            string            `json:"bus"`
+	Private        bool              `json:"private"`
+	Clonable       bool              `json:"clonable"`
+	Alg            string            `json:"alg"`
+	ImageSize      int64             `json:"imageSize"` // Bytes
+	ExpectedChunks int               `json:"expectedChunks"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+type CreateStorageUploadResponse struct {
+	VolumeID string `json:"vid"`
+}
+
+type FeedStorageUploadRequest struct {
+	VolumeID string `json:"vid"`
+	Chunk    int    `json:"chunk"`  // Index of the chunk, starting at 0
+	Offset   int64  `json:"offset"` // Bytes
+}
+
+// -------- CLONE STORAGE --------
+type CloneStorageRequest struct {
+	VolumeID string            `json:"volume_id"`
+	Name     string            `json:"name"`
+	Private  bool              `json:"private"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+type CloneStorageResponse struct {
+	VolumeID string `json:"vid"`
+}
+
+// -------- EXPORT STORAGE --------
+type ExportStorageRequest struct {
+	VolumeID string `json:"volume_id"`
+}
+
+type ExportStorageResponse struct {
+	VolumeID string `json:"vid"`
+	URL      string `json:"url"` // Download URL of the exported image, absolute or relative to the daemon
+	Format   string `json:"format"`
+	Size     int64  `json:"size"`               // Bytes
+	Checksum string `json:"checksum,omitempty"` // "<algorithm>:<hex digest>"
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 	"os"
 	"net"
+	"strconv"
+	"sync"
 
 	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
 )
@@ -24,16 +26,24 @@ type Server struct {
 	Labels       map[string]string
 	Volumes      []*schema.StorageVolume
 	PrivateNet   []ServerPrivateNet
+	IsGateway    bool
+	ServerURL    string // URL of the host running the VM
+	OSFamily     string
+	OSFlavour    string
 }
 
 type ServerType struct {
-	ID           int
-	Name         string
-	Description  string
-	Cores        int
-	Memory       float32
-	Disk         int
-	Architecture Architecture
+	ID            int
+	Name          string
+	Description   string
+	Cores         int
+	Memory        float32
+	Disk          int
+	Architecture  Architecture
+	Overprovision int
+	AllowSMT      bool
+	ReqECC        bool
+	Flags         []string
 }
 
 // ServerPrivateNet defines the schema of a Server's private network information.
@@ -42,6 +52,7 @@ type ServerPrivateNet struct {
 	IP         net.IP
 	Aliases    []net.IP
 	MACAddress string
+	Interface  string
 }
 
 // Architecture specifies the architecture of the CPU.
@@ -99,6 +110,34 @@ const (
 	ServerStatusUnknown ServerStatus = "unknown"
 )
 
+// serverStatusAliases maps the statuses reported by the compute daemon to ServerStatus.
+var serverStatusAliases = map[string]ServerStatus{
+	"initializing": ServerStatusInitializing,
+	"creating":     ServerStatusInitializing,
+	"pending":      ServerStatusInitializing,
+	"off":          ServerStatusOff,
+	"shutoff":      ServerStatusOff,
+	"shutdown":     ServerStatusOff,
+	"stopped":      ServerStatusOff,
+	"running":      ServerStatusRunning,
+	"active":       ServerStatusRunning,
+	"starting":     ServerStatusStarting,
+	"booting":      ServerStatusStarting,
+	"stopping":     ServerStatusStopping,
+	"migrating":    ServerStatusMigrating,
+	"rebuilding":   ServerStatusRebuilding,
+	"deleting":     ServerStatusDeleting,
+}
+
+// ServerStatusFromString normalizes a status reported by the compute daemon.
+// Unknown values are mapped to ServerStatusUnknown.
+func ServerStatusFromString(status string) ServerStatus {
+	if s, ok := serverStatusAliases[strings.ToLower(strings.TrimSpace(status))]; ok {
+		return s
+	}
+	return ServerStatusUnknown
+}
+
 // ServerPublicNet represents a server's public network.
 type ServerPublicNet struct {
 	IPv4        string
@@ -123,7 +162,7 @@ func (c *ServerClient) GetByID(ctx context.Context, id string) (*Server, *Respon
 	// Search for the server with the matching ID
 	for _, server := range *statusResp {
 		if server.UniqueID == id {
-			return ServerFromSchema(server), &Response{}, nil
+			return c.fromSchema(server), &Response{}, nil
 		}
 	}
 
@@ -143,6 +182,30 @@ func (c *ServerClient) GetByName(ctx context.Context, name string) (*Server, *Re
 	return servers[0], response, err
 }
 
+// fromSchema converts a schema.Server, reporting the status of client-side
+// operations (e.g. a rebuild) in progress on the server.
+func (c *ServerClient) fromSchema(s schema.Server) *Server {
+	server := ServerFromSchema(s)
+	if status, ok := c.client.serverStatus(server.Name); ok {
+		server.Status = status
+	}
+	return server
+}
+
+// getSchemaByID returns the server with the given ID as reported by the compute daemon.
+func (c *ServerClient) getSchemaByID(id string) (*schema.Server, error) {
+	body, err := c.client.GetCompute()
+	if err != nil {
+		return nil, err
+	}
+	for i := range *body {
+		if (*body)[i].UniqueID == id {
+			return &(*body)[i], nil
+		}
+	}
+	return nil, Error{Code: ErrorCodeNotFound, Message: fmt.Sprintf("server %s not found", id)}
+}
+
 // ServerListOpts specifies options for listing servers.
 type ServerListOpts struct {
 	ListOpts
@@ -152,14 +215,19 @@ type ServerListOpts struct {
 
 // List returns a list of servers.
 func (c *ServerClient) List(ctx context.Context, opts ServerListOpts) ([]*Server, *Response, error) {
-	body, err := c.client.GetCompute()
+	selector, err := ParseLabelSelector(opts.LabelSelector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := c.client.GetComputeWithOpts(opts.ListOpts)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	servers := make([]*Server, 0, len(*body))
 	for _, s := range *body {
-		server := ServerFromSchema(s)
+		server := c.fromSchema(s)
 
 		// Filter by name if specified
 		if opts.Name != "" && server.Name != opts.Name {
@@ -180,11 +248,70 @@ func (c *ServerClient) List(ctx context.Context, opts ServerListOpts) ([]*Server
 			}
 		}
 
+		// Filter by labels if specified
+		if !selector.Matches(server.Labels) {
+			continue
+		}
+
 		servers = append(servers, server)
 	}
 	return servers, &Response{}, nil
 }
 
+// ListGateways returns the gateway servers matching opts.
+func (c *ServerClient) ListGateways(ctx context.Context, opts ServerListOpts) ([]*Server, *Response, error) {
+	servers, resp, err := c.List(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	gateways := []*Server{}
+	for _, server := range servers {
+		if server.IsGateway {
+			gateways = append(gateways, server)
+		}
+	}
+	return gateways, resp, nil
+}
+
+// GatewayFor returns the gateway server of a private network. If the network
+// has no gateway, nil is returned.
+func (c *ServerClient) GatewayFor(ctx context.Context, network *Network) (*Server, *Response, error) {
+	if network == nil {
+		return nil, nil, errors.New("missing network")
+	}
+	gateways, resp, err := c.ListGateways(ctx, ServerListOpts{})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, gateway := range gateways {
+		if gateway.attachedTo(network) {
+			return gateway, resp, nil
+		}
+	}
+	return nil, resp, nil
+}
+
+// attachedTo reports whether the server has an interface on network, matched
+// by ID, name or, for unnamed interfaces, by IP address. The interfaces of a
+// server are named after their source, which may be the ID, the name or the
+// libvirt name of the network.
+func (s *Server) attachedTo(network *Network) bool {
+	for _, privateNet := range s.PrivateNet {
+		if n := privateNet.Network; n != nil {
+			if network.ID != "" && (n.ID == network.ID || n.Name == network.ID) {
+				return true
+			}
+			if (network.Name != "" && n.Name == network.Name) || (network.LibvirtNetwork != "" && n.Name == network.LibvirtNetwork) {
+				return true
+			}
+		}
+		if network.IPRange != nil && privateNet.IP != nil && network.IPRange.Contains(privateNet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
 // Update updates a server.
 func (c *ServerClient) Update(ctx context.Context, server *Server, opts ServerUpdateOpts) (*Server, *Response, error) {
 	return nil, nil, fmt.Errorf("server update operation is not yet supported")
@@ -209,6 +336,38 @@ type ServerCreateOpts struct {
 	Automount        *bool
 	Volumes          []*schema.StorageVolume
 	Networks         []*Network
+
+	// IdempotencyKey enables the idempotency mode: a server with the same name
+	// (and the same key, if labelled) is returned instead of creating a second
+	// one, and partially created volumes (e.g. "<name>-boot") are reused.
+	IdempotencyKey string
+
+	// BootDisk and DataDisks specify the disk layout of the server. Data disks
+	// are partitioned, formatted and mounted by cloud-init; without them, the
+	// data disk requested by ServerType.Disk is set up by the template commands.
+	BootDisk  *BootDiskSpec
+	DataDisks []DiskSpec
+
+	// Hardware requirements, validated against the compute template named
+	// after ServerType (if any, even for size flavours) and checked with canallocate.
+	CPUFlags      []string            // CPU flags required on the host (e.g. "avx2"), "sse2" if none
+	AllowSMT      bool                // Allow SMT sibling threads to be allocated as cores
+	ReqECC        bool                // Require ECC memory
+	Overprovision int                 // vCPUs per physical core, from the template (or 1) if not set
+	PCIDevices    []PCIDeviceSelector // PCI devices to pass through
+
+	// Gateway makes the server the gateway (NAT/bastion) of its networks,
+	// see GatewayFor.
+	Gateway bool
+
+	// PlacementGroup makes Create place the server on a provider/region not
+	// used by the other members of the group.
+	PlacementGroup *PlacementGroup
+
+	// WaitForIP makes Create wait until the server has an IPv4 address (inside
+	// the IP range of the first network, if any) before returning. If the wait
+	// fails, the server is kept and returned together with the error.
+	WaitForIP bool
 }
 
 // Create creates a new server.
@@ -217,116 +376,189 @@ func (c *ServerClient) Create(ctx context.Context, opts ServerCreateOpts) (Serve
 		return ServerCreateResult{}, nil, err
 	}
 
-	// Prepare the can allocate request according to the schema
-	reqBodyCanAllocate := schema.CanAllocateComputeRequest{
-		// TODO
+	// A retried call adopts the server created by a previous attempt
+	if opts.IdempotencyKey != "" {
+		existing, err := c.findAdoptable(ctx, opts.Name, opts.IdempotencyKey)
+		if err != nil {
+			return ServerCreateResult{}, nil, err
+		}
+		if existing != nil {
+			if opts.WaitForIP {
+				waitOpts, err := c.waitForIPOpts(ctx, opts)
+				if err != nil {
+					return ServerCreateResult{}, nil, err
+				}
+				server, _, err := c.WaitForIP(ctx, existing.ID, waitOpts)
+				if err != nil {
+					return ServerCreateResult{Server: existing}, nil, err
+				}
+				existing = server
+			}
+			return ServerCreateResult{Server: existing}, &Response{}, nil
+		}
 	}
 
-	// First check if we can allocate the compute instance
-	_, err := c.client.CanAllocateCompute(reqBodyCanAllocate)
+	prep, err := c.prepareCreate(ctx, opts)
 	if err != nil {
-		return ServerCreateResult{}, nil, fmt.Errorf("the config provided cannot be allocated: %w", err)
+		return ServerCreateResult{}, nil, err
 	}
+	defer prep.release()
+	reqBody := prep.reqBody
 
-	// Parse image to OS family and flavor
-	osFamily, osFlavour := parseImageToOS(opts.Image)
+	// Every resource created from here on is recorded, so that a later failure
+	// or a cancelled context deletes them again instead of leaking them
+	saga := &createSaga{}
 
-	// Prepare the request body according to the schema
-	reqBody := schema.CreateComputeRequest{
-		Info:    schema.Info{Name: opts.Name},
-		Flags:   []string{"sse2"},
-		Misc:    schema.Misc{OsFamily: osFamily, OsFlavour: osFlavour},
-		Pci:     []string{},
-		Volumes: []map[string]string{},
-		HasNetwork: true,
-		Networks: []map[string]string{},
-	}
-
-	// Add server type configuration
-	if opts.ServerType != nil {
-		// Check if ServerType has zero cores/memory but a valid size name
-		if opts.ServerType.Cores == 0 && opts.ServerType.Memory == 0 && opts.ServerType.Name != "" {
-			fmt.Printf("DEBUG: ServerType has zero cores/memory but name '%s', attempting size conversion\n", opts.ServerType.Name)
-			// Try to convert the ServerType name to a size configuration
-			sizeConfig, err := ConvertServerSize(opts.ServerType.Name)
-			if err == nil {
-				fmt.Printf("DEBUG: Successfully converted ServerType name '%s' to size config - Slots: %d, Ramsize: %d MB\n", opts.ServerType.Name, sizeConfig.Slots, sizeConfig.Ramsize)
-				reqBody.Slots = sizeConfig.Slots
-				reqBody.Overprovision = sizeConfig.Slots
-				reqBody.Ramsize = sizeConfig.Ramsize
-				// Use the ServerType's architecture if specified, otherwise default to x86_64
-				if opts.ServerType.Architecture != "" {
-					reqBody.Archs = []string{string(opts.ServerType.Architecture)}
-				} else {
-					reqBody.Archs = []string{string(ArchitectureX86_64)}
-				}
-			} else {
-				fmt.Printf("DEBUG: Failed to convert ServerType name '%s' to size config: %v\n", opts.ServerType.Name, err)
-				// Fall back to using the ServerType as-is (will result in 0 slots/ramsize)
-				reqBody.Slots = opts.ServerType.Cores
-				reqBody.Overprovision = opts.ServerType.Cores
-				reqBody.Ramsize = int(opts.ServerType.Memory * 1024) // Convert GB to MB
-				reqBody.Archs = []string{string(opts.ServerType.Architecture)}
-			}
-		} else {
-			// Use ServerType as-is
-			reqBody.Slots = opts.ServerType.Cores
-			reqBody.Overprovision = opts.ServerType.Cores
-			reqBody.Ramsize = int(opts.ServerType.Memory * 1024) // Convert GB to MB
-			reqBody.Archs = []string{string(opts.ServerType.Architecture)}
-		}
+	// Root login uses the SSH keys if given, a random password otherwise
+	layout := opts.diskLayout()
+	cloudInit, rootPassword, err := newCloudInitConfig(opts.Name, opts.UserData, layout, opts.SSHKeys)
+	if err != nil {
+		return ServerCreateResult{}, nil, err
 	}
 
 	// Add default boot volume to the vm
-	// TODO: configure cloudinit con default SSH key
-	sshKeyStrings := make([]string, len(opts.SSHKeys))
-	for i, k := range opts.SSHKeys {
-		sshKeyStrings[i] = k.PublicKey
-	}
-	bootvolumeIDs, err := createBootVolume(ctx, c.client, opts.Name, osFlavour, sshKeyStrings, opts.UserData)
+	bootvolumeIDs, cloudInitCreated, err := createBootVolume(ctx, c.client, saga, opts.Name, prep.image, layout.boot, cloudInit, opts.IdempotencyKey)
 	if err != nil {
-		return ServerCreateResult{}, nil, fmt.Errorf("failed to create boot volume: %w", err)
+		return ServerCreateResult{}, nil, saga.rollback(fmt.Errorf("failed to create boot volume: %w", err))
+	}
+	// An adopted cloud-init volume holds the password of a previous attempt
+	if !cloudInitCreated {
+		rootPassword = ""
 	}
 	for _, vid := range bootvolumeIDs {
 		reqBody.Volumes = append(reqBody.Volumes, map[string]string{"vid": vid})
 	}
 
-	// Add volumes if asked
-	// TODO: should i add a default boot volume even if not specified by kops?
-	if opts.ServerType.Disk > 0 {
-		volumeID, err := createVolume(ctx, c.client, opts.Name, opts.ServerType.Disk)
+	// Add data volumes if asked, in the attach order assumed by the cloud-init disk layout
+	for _, volumeOpts := range layout.dataVolumes(opts.Name, opts.IdempotencyKey) {
+		if err := ctx.Err(); err != nil {
+			return ServerCreateResult{}, nil, saga.rollback(err)
+		}
+		volumeID, err := createVolume(ctx, c.client, saga, volumeOpts)
 		if err != nil {
-			return ServerCreateResult{}, nil, fmt.Errorf("failed to create volume: %w", err)
+			return ServerCreateResult{}, nil, saga.rollback(fmt.Errorf("failed to create volume: %w", err))
 		}
 		reqBody.Volumes = append(reqBody.Volumes, map[string]string{"vid": volumeID})
 	}
 
-	// TODO: Add networks if provided
-	if len(opts.Networks) > 0 {
-		reqBody.Networks = make([]map[string]string, len(opts.Networks))
-		for i, network := range opts.Networks {
-			reqBody.Networks[i] = map[string]string{"network_uid": network.ID}
-		}
-	}
-
 	// Wait 15 seconds to allow the volumes to be fully initialized
-	time.Sleep(15 * time.Second)
+	if err := sleepContext(ctx, 15*time.Second); err != nil {
+		return ServerCreateResult{}, nil, saga.rollback(err)
+	}
 
 	// Create the compute instance
 	resp, err := c.client.CreateCompute(reqBody)
 	if err != nil {
-		return ServerCreateResult{}, nil, fmt.Errorf("failed to create compute instance: %w", err)
+		return ServerCreateResult{}, nil, saga.rollback(fmt.Errorf("failed to create compute instance: %w", err))
 	}
 
 	result := ServerCreateResult{
 		Server: ServerFromSchema(resp.Server),
 	}
-	if resp.RootPassword != nil {
-		result.RootPassword = *resp.RootPassword
+	result.RootPassword = rootPassword
+	if result.RootPassword == "" && resp.RootPassword != nil {
+		result.RootPassword = SecretString(*resp.RootPassword)
+	}
+
+	// The addresses are only known once DHCP completes. The server is created
+	// at this point: a slow lease returns it with the error instead of deleting it
+	if opts.WaitForIP {
+		server, _, err := c.WaitForIP(ctx, resp.Server.UniqueID, prep.waitOpts)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Server = server
 	}
 	return result, &Response{}, nil
 }
 
+// serverCreation holds what Create resolves and checks before creating anything.
+type serverCreation struct {
+	reqBody     schema.CreateComputeRequest // Registration request, without volumes
+	image       *Image
+	canAllocate *schema.CanAllocateComputeResponse
+	waitOpts    WaitForIPOpts
+	release     func() // Releases the placement reserved for the server
+}
+
+// prepareCreate resolves the size, image, placement and networks of the server
+// described by opts, and checks that it can be allocated.
+func (c *ServerClient) prepareCreate(ctx context.Context, opts ServerCreateOpts) (*serverCreation, error) {
+	prep := &serverCreation{release: func() {}}
+
+	// Resolve the image to its OS family, flavour and boot image
+	prep.image = resolveImage(ctx, opts.Image)
+
+	// Prepare the request body according to the schema
+	reqBody := schema.CreateComputeRequest{
+		Info:       schema.Info{Name: opts.Name},
+		Misc:       schema.Misc{OsFamily: prep.image.OSFamily, OsFlavour: prep.image.OSFlavour},
+		Volumes:    []map[string]string{},
+		HasNetwork: true,
+		Networks:   []map[string]string{},
+		Labels:     idempotencyLabels(opts.Labels, opts.IdempotencyKey),
+		IsGateway:  opts.Gateway,
+	}
+	sshKeyLabel, err := sshKeyLabels(opts.SSHKeys)
+	if err != nil {
+		return nil, err
+	}
+	reqBody.Labels = mergeLabels(reqBody.Labels, sshKeyLabel)
+	reqBody.Labels = mergeLabels(reqBody.Labels, dataDiskLabels(opts.diskLayout().data))
+
+	// Add server type configuration, from the size flavour or template catalog if needed
+	size, err := c.resolveValidatedSize(ctx, opts.ServerType)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyHardware(&reqBody, opts, size); err != nil {
+		return nil, err
+	}
+
+	// First check if we can allocate the compute instance
+	prep.canAllocate, err = c.client.CanAllocateCompute(canAllocateRequest(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("the config provided cannot be allocated: %w", err)
+	}
+	if len(prep.canAllocate.Mesos) == 0 {
+		return nil, Error{
+			Code:    ErrorCodeResourceUnavailable,
+			Message: fmt.Sprintf("no provider can allocate server %s with the requested hardware", opts.Name),
+		}
+	}
+
+	// Spread the members of the placement group over different providers/regions
+	if opts.PlacementGroup != nil {
+		placement, release, err := c.client.PlacementGroup.reserve(ctx, opts.PlacementGroup, prep.canAllocate.Mesos)
+		if err != nil {
+			return nil, err
+		}
+		prep.release = release
+		reqBody.Provider = placement.Provider
+		reqBody.Region = placement.Region
+		reqBody.Labels = mergeLabels(reqBody.Labels, placementLabels(opts.PlacementGroup, placement))
+	}
+
+	// TODO: Add networks if provided
+	if len(opts.Networks) > 0 {
+		reqBody.Networks = make([]map[string]string, len(opts.Networks))
+		for i, network := range opts.Networks {
+			reqBody.Networks[i] = map[string]string{"network_uid": network.ID}
+		}
+	}
+
+	// Resolve the network to wait for before creating anything
+	if opts.WaitForIP {
+		if prep.waitOpts, err = c.waitForIPOpts(ctx, opts); err != nil {
+			prep.release()
+			return nil, err
+		}
+	}
+
+	prep.reqBody = reqBody
+	return prep, nil
+}
+
 // Validate checks if options are valid.
 func (o ServerCreateOpts) Validate() error {
 	if o.Name == "" {
@@ -338,13 +570,204 @@ func (o ServerCreateOpts) Validate() error {
 	if o.Datacenter == nil {
 		return errors.New("missing datacenter")
 	}
-	return nil
+	if o.BootDisk != nil {
+		if err := o.BootDisk.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, disk := range o.DataDisks {
+		if err := disk.Validate(); err != nil {
+			return err
+		}
+	}
+	return o.validateHardware()
+}
+
+// waitForIPOpts returns the options used by Create to wait for the server's IP
+// address, looking up the IP range of the first network if it is not known.
+func (c *ServerClient) waitForIPOpts(ctx context.Context, opts ServerCreateOpts) (WaitForIPOpts, error) {
+	if len(opts.Networks) == 0 {
+		return WaitForIPOpts{}, nil
+	}
+	network := opts.Networks[0]
+	if network.IPRange == nil && network.ID != "" {
+		found, err := lookupCacheFrom(ctx).network(ctx, c.client, network.ID)
+		if err != nil {
+			return WaitForIPOpts{}, fmt.Errorf("failed to look up network %s: %w", network.ID, err)
+		}
+		if found != nil {
+			network = found
+		}
+	}
+	return WaitForIPOpts{Network: network}, nil
+}
+
+// WaitForIPOpts specifies options for waiting for a server's IP address.
+type WaitForIPOpts struct {
+	Network  *Network      // If set, wait for an address inside Network.IPRange
+	Interval time.Duration // Polling interval, 5 seconds if not set
+	Timeout  time.Duration // Maximum waiting time, 5 minutes if not set
+}
+
+// WaitForIP polls the server until it has an IPv4 address and returns it with
+// its addresses filled in. If opts.Network has an IP range, the server must
+// have an address inside it.
+func (c *ServerClient) WaitForIP(ctx context.Context, id string, opts WaitForIPOpts) (*Server, *Response, error) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		body, err := c.client.GetCompute()
+		if err != nil {
+			return nil, nil, err
+		}
+		// The server may not be listed yet right after its creation
+		for _, s := range *body {
+			if s.UniqueID != id {
+				continue
+			}
+			server := c.fromSchema(s)
+			if server.hasIP(opts.Network) {
+				return server, &Response{}, nil
+			}
+		}
+
+		if err := sleepContext(ctx, interval); err != nil {
+			return nil, nil, fmt.Errorf("timed out waiting for IP address of server %s: %w", id, err)
+		}
+	}
+}
+
+// hasIP reports whether the server has an IPv4 address, inside the IP range
+// of network if it has one.
+func (s *Server) hasIP(network *Network) bool {
+	if network == nil || network.IPRange == nil {
+		return s.PublicNet.IPv4 != ""
+	}
+	ips := []net.IP{parseIP(s.PublicNet.IPv4)}
+	for _, privateNet := range s.PrivateNet {
+		ips = append(ips, privateNet.IP)
+		ips = append(ips, privateNet.Aliases...)
+	}
+	for _, ip := range ips {
+		if ip != nil && network.IPRange.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// findAdoptable returns the server named name that a create call using the
+// idempotency key may adopt, or nil if there is none.
+func (c *ServerClient) findAdoptable(ctx context.Context, name string, key string) (*Server, error) {
+	servers, _, err := c.List(ctx, ServerListOpts{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		if err := checkIdempotencyKey("server", name, server.Labels, key); err != nil {
+			return nil, err
+		}
+		return server, nil
+	}
+	return nil, nil
 }
 
 // ServerCreateResult is the result of a create server call.
 type ServerCreateResult struct {
 	Server       *Server
-	RootPassword string
+	RootPassword SecretString // Empty if root password login is disabled or unknown
+}
+
+// BatchOpts specifies options for creating servers in batch.
+type BatchOpts struct {
+	Concurrency int  // Maximum number of concurrent creations, 5 if not set
+	FailFast    bool // Stop starting new creations after the first failure, the ones in progress complete
+}
+
+// errCreationSkipped is the error of the creations a fail-fast batch did not start.
+var errCreationSkipped = errors.New("creation not started after a previous failure")
+
+// ServerCreateBatchResult is the result of a single creation of a batch.
+type ServerCreateBatchResult struct {
+	Index  int // Index of the creation in the opts passed to CreateMany
+	Result ServerCreateResult
+	Err    error
+}
+
+// CreateMany creates servers concurrently, running at most batchOpts.Concurrency
+// creations at a time. Templates, images and networks are looked up once for the
+// whole batch. Results are returned in the order of opts, together with the
+// errors of the failed creations joined. In fail-fast mode, the creations not
+// started yet after the first failure fail with errCreationSkipped, while the
+// creations in progress are left to complete.
+func (c *ServerClient) CreateMany(ctx context.Context, opts []ServerCreateOpts, batchOpts BatchOpts) ([]ServerCreateBatchResult, error) {
+	concurrency := batchOpts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+
+	ctx = withLookupCache(ctx)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	results := make([]ServerCreateBatchResult, len(opts))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := range opts {
+		results[i].Index = i
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case <-stop:
+			results[i].Err = errCreationSkipped
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			<-sem
+			results[i].Err = err
+			continue
+		}
+		select {
+		case <-stop:
+			<-sem
+			results[i].Err = errCreationSkipped
+			continue
+		default:
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, _, err := c.Create(ctx, opts[i])
+			results[i].Result = result
+			results[i].Err = err
+			if err != nil && batchOpts.FailFast {
+				stopOnce.Do(func() { close(stop) })
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var errs []error
+	for i, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("server %q: %w", opts[i].Name, result.Err))
+		}
+	}
+	return results, errors.Join(errs...)
 }
 
 // Deletes a server
@@ -356,10 +779,481 @@ func (c *ServerClient) Delete(ctx context.Context, server *Server) (*schema.Dele
 	return resp, err
 }
 
+// ServerRebuildOpts specifies options for rebuilding a server.
+type ServerRebuildOpts struct {
+	Image    string // Image name (e.g., "ubuntu-24-04"), the current OS if not set
+	UserData string
+	SSHKeys  []*SSHKey // Keys authorized for root, the keys the server was created with, looked up with SSHKeyClient, if not set
+}
+
+// ServerRebuildResult is the result of a rebuild server call.
+type ServerRebuildResult struct {
+	Server       *Server
+	RootPassword SecretString // Empty if root password login is disabled
+}
+
+// Rebuild reinstalls a server from a fresh image while keeping its identity:
+// the "-boot" and "-cloudinit" volumes are replaced with new ones, while the
+// data volumes, networks, size, name, labels and root SSH keys are kept. The
+// boot disk keeps its size and bus; data volumes are never formatted, the data
+// disk of ServerType.Disk and the DataDisks with a mount point are mounted
+// again. Without opts.SSHKeys, the keys recorded in the LabelSSHKeys label of
+// the server are looked up, and the rebuild fails if they cannot be found; a
+// server created without SSH keys gets a new root password. The server is
+// reported as ServerStatusRebuilding while the rebuild is in progress.
+//
+// The old boot volumes are deleted once the server is unregistered, before the
+// new ones are created, so that volume names stay unique: if the rebuild fails
+// after that, the new volumes are deleted, the server is not registered again
+// and an error saying it cannot be restored is returned; its data volumes are
+// left unattached.
+func (c *ServerClient) Rebuild(ctx context.Context, server *Server, opts ServerRebuildOpts) (ServerRebuildResult, *Response, error) {
+	if server == nil {
+		return ServerRebuildResult{}, nil, errors.New("missing server")
+	}
+	current, err := c.getSchemaByID(server.ID)
+	if err != nil {
+		return ServerRebuildResult{}, nil, err
+	}
+
+	name := server.Name
+	c.client.setServerStatus(name, ServerStatusRebuilding)
+	defer c.client.clearServerStatus(name)
+	server.Status = ServerStatusRebuilding
+
+	original, err := c.registerRequestFromSchema(*current)
+	if err != nil {
+		return ServerRebuildResult{}, nil, err
+	}
+	imageName := opts.Image
+	if imageName == "" {
+		imageName = original.Misc.OsFlavour
+	}
+	image := resolveImage(ctx, imageName)
+
+	sshKeys := opts.SSHKeys
+	if len(sshKeys) == 0 {
+		if sshKeys, err = c.recoverSSHKeys(ctx, name, current.Labels); err != nil {
+			return ServerRebuildResult{}, nil, err
+		}
+	}
+	sshKeyLabel, err := sshKeyLabels(sshKeys)
+	if err != nil {
+		return ServerRebuildResult{}, nil, err
+	}
+	layout := rebuildLayout(name, *current)
+	cloudInit, rootPassword, err := newCloudInitConfig(name, opts.UserData, layout, sshKeys)
+	if err != nil {
+		return ServerRebuildResult{}, nil, err
+	}
+
+	// Check that the new boot volume fits before touching the server
+	if _, err := c.client.CanCreateStorage(schema.CanCreateStorageRequest{Size: layout.boot.Size}); err != nil {
+		return ServerRebuildResult{}, nil, fmt.Errorf("the boot volume cannot be created: %w", err)
+	}
+
+	// Keep the data volumes, replacing the boot and cloud-init ones
+	var oldVolumeIDs []string
+	for _, vol := range serverVolumes(*current) {
+		if isSystemVolume(name, vol) {
+			oldVolumeIDs = append(oldVolumeIDs, vol.VolumeID)
+		}
+	}
+
+	saga := &createSaga{}
+	rebuilt, err := c.reregister(current, original, func(reqBody *schema.CreateComputeRequest) error {
+		for _, vid := range oldVolumeIDs {
+			if _, err := c.client.DeleteStorage(schema.DeleteStorageRequest{VolumeID: vid}); err != nil {
+				return fmt.Errorf("failed to delete old volume %s: %w", vid, err)
+			}
+			reqBody.Volumes = withoutVolume(reqBody.Volumes, vid)
+		}
+
+		bootvolumeIDs, _, err := createBootVolume(ctx, c.client, saga, name, image, layout.boot, cloudInit, "")
+		if err != nil {
+			return fmt.Errorf("failed to create boot volume: %w", err)
+		}
+		volumes := []map[string]string{}
+		for _, vid := range bootvolumeIDs {
+			volumes = append(volumes, map[string]string{"vid": vid})
+		}
+		reqBody.Volumes = append(volumes, reqBody.Volumes...)
+		reqBody.Misc = schema.Misc{OsFamily: image.OSFamily, OsFlavour: image.OSFlavour}
+		reqBody.Labels = mergeLabels(reqBody.Labels, sshKeyLabel)
+
+		// Wait 15 seconds to allow the volumes to be fully initialized
+		return sleepContext(ctx, 15*time.Second)
+	})
+	if err != nil {
+		return ServerRebuildResult{}, nil, saga.rollback(err)
+	}
+	return ServerRebuildResult{Server: ServerFromSchema(*rebuilt), RootPassword: rootPassword}, &Response{}, nil
+}
+
+// ServerChangeTypeOpts specifies options for changing the type of a server.
+type ServerChangeTypeOpts struct {
+	// UpgradeDisk grows the data volume to ServerType.Disk GB if it is smaller.
+	// Requires CapabilityVolumeResize, see WithCapabilities.
+	UpgradeDisk bool
+}
+
+// ChangeType moves a server to another size flavour (e.g. from "neon" to
+// "kripton"). The new configuration is validated with canallocate before the
+// server is touched; the VM is then stopped by unregistering it and registered
+// again with the new slots and RAM, the same volumes, networks, labels and
+// hardware options. ServerType.Overprovision, if set, replaces the overprovision.
+func (c *ServerClient) ChangeType(ctx context.Context, server *Server, serverType *ServerType, opts ServerChangeTypeOpts) (*Server, *Response, error) {
+	if server == nil {
+		return nil, nil, errors.New("missing server")
+	}
+	if serverType == nil {
+		return nil, nil, errors.New("missing server type")
+	}
+	current, err := c.getSchemaByID(server.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	size, err := c.resolveValidatedSize(ctx, serverType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	original, err := c.registerRequestFromSchema(*current)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The overprovision and hardware options of the server are kept, unless
+	// the new type overrides them, and validated against its compute template
+	resize := func(reqBody *schema.CreateComputeRequest) error {
+		reqBody.Slots = size.Slots
+		reqBody.Ramsize = size.Ramsize
+		if serverType.Overprovision > 0 {
+			reqBody.Overprovision = serverType.Overprovision
+		}
+		if serverType.Architecture != "" {
+			reqBody.Archs = []string{string(serverType.Architecture)}
+		}
+		if size.template != nil {
+			return applyTemplate(reqBody, size.template)
+		}
+		return nil
+	}
+
+	// Validate the new configuration before touching the running server
+	checked := cloneRegisterRequest(original)
+	if err := resize(&checked); err != nil {
+		return nil, nil, err
+	}
+	canAllocate, err := c.client.CanAllocateCompute(canAllocateRequest(checked))
+	if err != nil {
+		return nil, nil, fmt.Errorf("the config provided cannot be allocated: %w", err)
+	}
+	if len(canAllocate.Mesos) == 0 {
+		return nil, nil, Error{
+			Code:    ErrorCodeResourceUnavailable,
+			Message: fmt.Sprintf("no provider can allocate %d slots and %d MB of RAM", size.Slots, size.Ramsize),
+		}
+	}
+
+	var dataVolume *schema.StorageVolume
+	if opts.UpgradeDisk {
+		if err := c.client.requireCapability(CapabilityVolumeResize); err != nil {
+			return nil, nil, err
+		}
+		for _, vol := range serverVolumes(*current) {
+			if !isSystemVolume(current.Name, vol) {
+				dataVolume = &vol
+				break
+			}
+		}
+		if dataVolume == nil {
+			return nil, nil, fmt.Errorf("server %s has no data volume to upgrade", server.Name)
+		}
+		if serverType.Disk <= int(dataVolume.Size) {
+			dataVolume = nil
+		} else if _, err := c.client.CanCreateStorage(schema.CanCreateStorageRequest{Size: serverType.Disk - int(dataVolume.Size)}); err != nil {
+			return nil, nil, fmt.Errorf("the data volume cannot be grown to %d GB: %w", serverType.Disk, err)
+		}
+	}
+
+	updated, err := c.reregister(current, original, func(reqBody *schema.CreateComputeRequest) error {
+		if err := resize(reqBody); err != nil {
+			return err
+		}
+		if dataVolume != nil {
+			if _, err := c.client.ResizeStorage(schema.ResizeStorageRequest{VolumeID: dataVolume.VolumeID, Size: serverType.Disk}); err != nil {
+				return fmt.Errorf("failed to grow data volume: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ServerFromSchema(*updated), &Response{}, nil
+}
+
+// resolveServerSize returns the slots and RAM of a server type: its cores and
+// memory if set, otherwise the size flavour or compute template named after it.
+func (c *ServerClient) resolveServerSize(ctx context.Context, serverType *ServerType) (*ServerSizeConfig, error) {
+	if serverType.Cores > 0 && serverType.Memory > 0 {
+		return &ServerSizeConfig{
+			Slots:   serverType.Cores,
+			Ramsize: int(serverType.Memory * 1024), // Convert GB to MB
+		}, nil
+	}
+	if sizeConfig, err := ConvertServerSize(serverType.Name); err == nil {
+		return sizeConfig, nil
+	}
+
+	template, err := c.findComputeTemplate(ctx, serverType.Name)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, Error{
+			Code:    ErrorCodeInvalidServerType,
+			Message: fmt.Sprintf("unknown server type %q", serverType.Name),
+		}
+	}
+	return &ServerSizeConfig{
+		Slots:    template.CPU.Slots,
+		Ramsize:  template.RAM.Ramsize,
+		template: template,
+	}, nil
+}
+
+// resolveValidatedSize returns the size of a server type as resolveServerSize,
+// with the compute template named after it (if any) even when its slots and
+// RAM come from the type or a size flavour, so that every size is validated
+// against the catalog.
+func (c *ServerClient) resolveValidatedSize(ctx context.Context, serverType *ServerType) (*ServerSizeConfig, error) {
+	size, err := c.resolveServerSize(ctx, serverType)
+	if err != nil {
+		return nil, err
+	}
+	if size.template == nil {
+		if size.template, err = c.findComputeTemplate(ctx, serverType.Name); err != nil {
+			return nil, err
+		}
+	}
+	return size, nil
+}
+
+// findComputeTemplate returns the compute template named name, or nil if there is none.
+func (c *ServerClient) findComputeTemplate(ctx context.Context, name string) (*schema.ComputeTemplate, error) {
+	templates, err := lookupCacheFrom(ctx).computeTemplates(c.client)
+	if err != nil {
+		return nil, err
+	}
+	for i := range *templates {
+		template := &(*templates)[i]
+		if strings.EqualFold(template.Info.Name, strings.TrimSpace(name)) {
+			return template, nil
+		}
+	}
+	return nil, nil
+}
+
+// canAllocateRequest returns the canallocate request checking whether reqBody can be registered.
+func canAllocateRequest(reqBody schema.CreateComputeRequest) schema.CanAllocateComputeRequest {
+	return schema.CanAllocateComputeRequest{
+		Slots:         reqBody.Slots,
+		Overprovision: reqBody.Overprovision,
+		AllowSMT:      reqBody.AllowSMT,
+		Archs:         reqBody.Archs,
+		Flags:         reqBody.Flags,
+		Ramsize:       reqBody.Ramsize,
+		ReqECC:        reqBody.ReqECC,
+		Misc:          reqBody.Misc,
+		Pci:           reqBody.Pci,
+	}
+}
+
+// serverVolumes returns the volumes attached to the VM described by s.
+func serverVolumes(s schema.Server) []schema.StorageVolume {
+	if len(s.Volumes) > 0 {
+		return s.Volumes
+	}
+	return s.ReqJSON.Volumes
+}
+
+// registerRequestFromSchema returns the request registering again the VM
+// described by s, with the same name, size, volumes, networks, labels and
+// placement (the provider and region of its labels, if any).
+func (c *ServerClient) registerRequestFromSchema(s schema.Server) (schema.CreateComputeRequest, error) {
+	rc := s.ReqJSON
+	name := s.Name
+	if name == "" {
+		name = rc.VMName
+	}
+
+	reqBody := schema.CreateComputeRequest{
+		Info:          schema.Info{Name: name},
+		Slots:         rc.Slots,
+		Overprovision: rc.Overprovision,
+		AllowSMT:      rc.AllowSMT,
+		Archs:         []string{rc.Arch},
+		Flags:         rc.Flags,
+		Ramsize:       int(rc.RamSize), // Already in MB, see GetCompute
+		ReqECC:        rc.ReqECC,
+		Misc:          schema.Misc{OsFamily: rc.OSFamily, OsFlavour: rc.OSFlavour},
+		Pci:           rc.PciDevs,
+		Volumes:       []map[string]string{},
+		HasNetwork:    true,
+		Networks:      []map[string]string{},
+		Labels:        s.Labels,
+		IsGateway:     s.IsGateway,
+	}
+	if reqBody.Flags == nil {
+		reqBody.Flags = []string{}
+	}
+	if reqBody.Pci == nil {
+		reqBody.Pci = []string{}
+	}
+	for _, vol := range serverVolumes(s) {
+		reqBody.Volumes = append(reqBody.Volumes, volumeAttachment(vol))
+	}
+
+	// Keep the server where it was placed, so that its placement labels stay true
+	reqBody.Provider = s.Labels[LabelProvider]
+	reqBody.Region = s.Labels[LabelRegion]
+
+	// The VM reports its networks by name or ID, registration needs their IDs
+	if refs := serverNetworkRefs(s); len(refs) > 0 {
+		networks, err := c.client.ListNetwork()
+		if err != nil {
+			return schema.CreateComputeRequest{}, err
+		}
+		reqBody.Networks, err = registerNetworks(name, refs, *networks)
+		if err != nil {
+			return schema.CreateComputeRequest{}, err
+		}
+	}
+
+	return reqBody, nil
+}
+
+// serverNetworkRefs returns the networks of s as it reports them: its
+// network devices, then the source of its network config.
+func serverNetworkRefs(s schema.Server) []string {
+	refs := make([]string, 0, len(s.ReqJSON.NetDevs)+1)
+	for _, netdev := range s.ReqJSON.NetDevs {
+		if netdev != "" {
+			refs = append(refs, netdev)
+		}
+	}
+	if source := s.NetworkConfig.Source; source != "" {
+		refs = append(refs, source)
+	}
+	return refs
+}
+
+// registerNetworks returns the register networks attaching the server name to
+// the networks refs, each matched by ID, name or libvirt network. A network
+// referenced more than once is attached once.
+func registerNetworks(name string, refs []string, networks []schema.Network) ([]map[string]string, error) {
+	attachments := []map[string]string{}
+	attached := make(map[string]bool)
+	for _, ref := range refs {
+		found := false
+		for _, n := range networks {
+			if n.NetworkID == ref || n.Name == ref || n.LibvirtNetwork == ref {
+				if !attached[n.NetworkID] {
+					attachments = append(attachments, map[string]string{"network_uid": n.NetworkID})
+					attached[n.NetworkID] = true
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, Error{
+				Code:    ErrorCodeNotFound,
+				Message: fmt.Sprintf("network %s of server %s not found, it cannot be registered again", ref, name),
+			}
+		}
+	}
+	return attachments, nil
+}
+
+// volumeAttachment returns the register volume attaching vol as the VM
+// reports it, on the same bus and as read-only if it is.
+func volumeAttachment(vol schema.StorageVolume) map[string]string {
+	attachment := map[string]string{"vid": vol.VolumeID}
+	if vol.Bus != "" {
+		attachment["bus"] = vol.Bus
+	}
+	if vol.Readonly {
+		attachment["readonly"] = strconv.FormatBool(vol.Readonly)
+	}
+	return attachment
+}
+
+// reregister replaces the registration of the VM described by current, as the
+// daemons only apply changes at registration: the VM is unregistered, update
+// changes a copy of original (and may act on the unregistered VM, e.g. resize
+// its volumes), then the VM is registered with it. If update or the
+// registration fails, the VM is registered again with original, unless a
+// volume of original no longer exists: the VM is then left unregistered.
+func (c *ServerClient) reregister(current *schema.Server, original schema.CreateComputeRequest, update func(*schema.CreateComputeRequest) error) (*schema.Server, error) {
+	if _, err := c.client.DeleteCompute(schema.DeleteComputeRequest{VolumeID: current.UniqueID}); err != nil {
+		return nil, fmt.Errorf("failed to unregister server: %w", err)
+	}
+
+	// restore registers the server again with its original configuration,
+	// unless update deleted one of its volumes
+	restore := func(cause error) error {
+		for _, attachment := range original.Volumes {
+			if _, err := c.client.Volume.getSchemaByID(attachment["vid"]); IsError(err, ErrorCodeNotFound) {
+				return errors.Join(cause, fmt.Errorf("server %s cannot be restored, its volume %s no longer exists", original.Info.Name, attachment["vid"]))
+			}
+		}
+		if _, err := c.client.CreateCompute(original); err != nil {
+			return errors.Join(cause, fmt.Errorf("failed to restore server %s: %w", original.Info.Name, err))
+		}
+		return cause
+	}
+
+	reqBody := cloneRegisterRequest(original)
+	if err := update(&reqBody); err != nil {
+		return nil, restore(err)
+	}
+	resp, err := c.client.CreateCompute(reqBody)
+	if err != nil {
+		return nil, restore(fmt.Errorf("failed to register server %s again: %w", original.Info.Name, err))
+	}
+	return &resp.Server, nil
+}
+
+// cloneRegisterRequest returns a copy of reqBody that can be changed without
+// changing reqBody.
+func cloneRegisterRequest(reqBody schema.CreateComputeRequest) schema.CreateComputeRequest {
+	clone := reqBody
+	clone.Archs = append([]string{}, reqBody.Archs...)
+	clone.Flags = append([]string{}, reqBody.Flags...)
+	clone.Pci = append([]string{}, reqBody.Pci...)
+	clone.Volumes = cloneAttachments(reqBody.Volumes)
+	clone.Networks = cloneAttachments(reqBody.Networks)
+	clone.Labels = mergeLabels(reqBody.Labels, nil)
+	return clone
+}
+
+// cloneAttachments returns a deep copy of the volumes or networks of a register request.
+func cloneAttachments(attachments []map[string]string) []map[string]string {
+	clone := make([]map[string]string, len(attachments))
+	for i, attachment := range attachments {
+		clone[i] = mergeLabels(attachment, nil)
+	}
+	return clone
+}
+
 // ServerSizeConfig represents the configuration for a server size
 type ServerSizeConfig struct {
 	Slots   int // vCPUs
 	Ramsize int // RAM in MB
+
+	template *schema.ComputeTemplate // Compute template the size comes from, if any
 }
 
 // ConvertServerSize converts a server size falvour name to its corresponding
@@ -409,6 +1303,21 @@ func ConvertServerSize(size string) (*ServerSizeConfig, error) {
 	}
 }
 
+// serverSizeNames lists the size flavours supported by ConvertServerSize.
+var serverSizeNames = []string{"helium", "neon", "argon2", "argon", "kripton"}
+
+// serverSizeName returns the size flavour matching the given slots and
+// ramsize (MB), or an empty string if there is none.
+func serverSizeName(slots int, ramsize int) string {
+	for _, name := range serverSizeNames {
+		config, _ := ConvertServerSize(name)
+		if config.Slots == slots && config.Ramsize == ramsize {
+			return name
+		}
+	}
+	return ""
+}
+
 // parses an image name and returns Elemento OS family and flavor
 func parseImageToOS(image string) (string, string) {
 	normalizedImage := strings.ToLower(strings.TrimSpace(image))
@@ -447,25 +1356,19 @@ func parseImageToOS(image string) (string, string) {
 	return "linux", "ubuntu"
 }
 
-// Creates a volume to provide into the vm in the creation phase
-func createVolume(ctx context.Context, client *Client, serverName string, diskSizeGB int) (string, error) {
+// Creates a volume to provide into the vm in the creation phase, recording it in saga.
+// With an idempotency key an existing volume is reused and not recorded.
+func createVolume(ctx context.Context, client *Client, saga *createSaga, volumeOpts VolumeCreateOpts) (string, error) {
 	volumeClient := &VolumeClient{client: client}
 
-	// Create volume options
-	volumeOpts := VolumeCreateOpts{
-		Name:      serverName,
-		Size:      diskSizeGB,
-		Bootable:  true,
-		Readonly:  false,
-		Shareable: false,
-		Private:   true,
-	}
-
 	// Create the volume
-	volumeID, _, err := volumeClient.Create(ctx, volumeOpts)
+	volumeID, created, _, err := volumeClient.ensure(ctx, volumeOpts)
 	if err != nil {
 		return "", fmt.Errorf("failed to create volume: %w", err)
 	}
+	if created {
+		saga.trackVolume(client, volumeID)
+	}
 
 	return volumeID, nil
 }
@@ -473,44 +1376,155 @@ func createVolume(ctx context.Context, client *Client, serverName string, diskSi
 // Creates the default boot volume with the image requested, returns the volumeID of:
 // - boot volume with the image of the requested OS
 // - volume containing the cloudinit
-func createBootVolume(ctx context.Context, client *Client, serverName string, osFlavour string, sshKey []string, userData string) ([]string, error) {
+// and whether the cloud-init volume was created rather than adopted.
+// Each created volume is recorded in saga, so the caller can remove them on failure.
+// With an idempotency key existing volumes are reused and not recorded.
+func createBootVolume(ctx context.Context, client *Client, saga *createSaga, serverName string, image *Image, boot BootDiskSpec, cloudInit cloudInitConfig, idempotencyKey string) ([]string, bool, error) {
 	volumeClient := &VolumeClient{client: client}
 	volumeIDs := []string{}
 
 	// Create boot volume with specified image
-	//! TODO: only ubuntu image supported for now, add more os and version support in the future
-	volumeOpts := VolumeCreateOpts{
-		Name: fmt.Sprintf("%s-boot", serverName),
-		Size: 50,
-		Url:  "https://cloud-images.ubuntu.com/jammy/current/jammy-server-cloudimg-amd64.img",
-	}
-
-	volumeIDboot, _, err := volumeClient.Create(ctx, volumeOpts)
+	volumeIDboot, created, _, err := volumeClient.ensure(ctx, bootVolumeOpts(serverName, image, boot, idempotencyKey))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create volume: %w", err)
+		return nil, false, fmt.Errorf("failed to create volume: %w", err)
+	}
+	if created {
+		saga.trackVolume(client, volumeIDboot)
 	}
 	volumeIDs = append(volumeIDs, volumeIDboot)
 
-	// CloudInit volume creation
-	cloudinitOpts := CloudInitCreateOpts{
-		Name: serverName,
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
 	}
-	volumeIDcloudinit, _, err := volumeClient.CreateCloudInit(ctx, cloudinitOpts, userData)
+
+	// CloudInit volume creation
+	content := renderCloudInit(cloudInit)
+	volumeIDcloudinit, created, _, err := volumeClient.ensureCloudInit(ctx, cloudInitOpts(serverName, idempotencyKey), content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cloud-init volume: %w", err)
+		return nil, false, fmt.Errorf("failed to create cloud-init volume: %w", err)
 	}
 	volumeIDs = append(volumeIDs, volumeIDcloudinit)
 
-	// Wait 5 seconds to allow the volume to be fully initialized
-	time.Sleep(5 * time.Second)
+	if created {
+		saga.trackVolume(client, volumeIDcloudinit)
+
+		// Wait 5 seconds to allow the volume to be fully initialized
+		if err := sleepContext(ctx, 5*time.Second); err != nil {
+			return nil, false, err
+		}
+	}
 
-	// Feed other file inside cloud-init volume
+	// Feed other file inside cloud-init volume. An adopted volume is fed again:
+	// the attempt that created it may have failed before feeding it
 	_, _, err = volumeClient.FeedFileIntoCloudInitStorage(ctx, volumeIDcloudinit)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return volumeIDs, nil
+	return volumeIDs, created, nil
+}
+
+// newCloudInitConfig returns the cloud-init configuration of a server. Root
+// login uses sshKeys if given, with password login disabled; otherwise a random
+// root password is generated and returned.
+func newCloudInitConfig(serverName string, userData string, layout diskLayout, sshKeys []*SSHKey) (cloudInitConfig, SecretString, error) {
+	cfg := cloudInitConfig{
+		Hostname: serverName,
+		UserData: userData,
+		Layout:   layout,
+		SSHKeys:  sshPublicKeys(sshKeys),
+	}
+	if len(cfg.SSHKeys) > 0 {
+		return cfg, "", nil
+	}
+	password, hash, err := newRootPassword()
+	if err != nil {
+		return cloudInitConfig{}, "", err
+	}
+	cfg.PasswordHash = hash
+	return cfg, password, nil
+}
+
+// recoverSSHKeys returns the keys recorded in the labels of the server name by
+// sshKeyLabels, looked up by fingerprint or name. It fails if the labels do not
+// record the keys, e.g. if the daemon dropped them, or a key is not found.
+func (c *ServerClient) recoverSSHKeys(ctx context.Context, name string, labels map[string]string) ([]*SSHKey, error) {
+	refs, ok := labelledSSHKeys(labels)
+	if !ok {
+		return nil, Error{
+			Code:    ErrorCodeNotFound,
+			Message: fmt.Sprintf("the SSH keys of server %s are not recorded in its labels, set them in the rebuild options", name),
+		}
+	}
+	keys := make([]*SSHKey, 0, len(refs))
+	for _, ref := range refs {
+		opts := SSHKeyListOpts{Name: ref}
+		if isSSHKeyFingerprint(ref) {
+			opts = SSHKeyListOpts{Fingerprint: ref}
+		}
+		found, err := c.client.SSHKey.AllWithOpts(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, Error{
+				Code:    ErrorCodeNotFound,
+				Message: fmt.Sprintf("SSH key %s of server %s not found, set the keys in the rebuild options", ref, name),
+			}
+		}
+		keys = append(keys, found[0])
+	}
+	return keys, nil
+}
+
+// sshPublicKeys returns the public keys of keys.
+func sshPublicKeys(keys []*SSHKey) []string {
+	publicKeys := []string{}
+	for _, key := range keys {
+		if key != nil && key.PublicKey != "" {
+			publicKeys = append(publicKeys, key.PublicKey)
+		}
+	}
+	return publicKeys
+}
+
+// dataVolumeOpts returns the options of a data volume of a server.
+func dataVolumeOpts(name string, diskSizeGB int, idempotencyKey string) VolumeCreateOpts {
+	return VolumeCreateOpts{
+		Name:      name,
+		Size:      diskSizeGB,
+		Bootable:  false,
+		Readonly:  false,
+		Shareable: false,
+		Private:   true,
+
+		IdempotencyKey: idempotencyKey,
+	}
+}
+
+// bootVolumeOpts returns the options of the boot volume of a server, holding image.
+func bootVolumeOpts(serverName string, image *Image, boot BootDiskSpec, idempotencyKey string) VolumeCreateOpts {
+	if boot.Size == 0 {
+		boot.Size = defaultBootDiskSize
+	}
+	return VolumeCreateOpts{
+		Name:     fmt.Sprintf("%s-boot", serverName),
+		Size:     boot.Size,
+		Url:      image.URL,
+		Bus:      boot.Bus,
+		Private:  !boot.Shared,
+		Checksum: image.Checksum,
+
+		IdempotencyKey: idempotencyKey,
+	}
+}
+
+// cloudInitOpts returns the options of the cloud-init volume of a server.
+func cloudInitOpts(serverName string, idempotencyKey string) CloudInitCreateOpts {
+	return CloudInitCreateOpts{
+		Name:           serverName,
+		IdempotencyKey: idempotencyKey,
+	}
 }
 
 func SaveCloudInitToFile(userData string, fileName string) error {
@@ -2,10 +2,13 @@ package ecloud
 
 import (
 	"context"
+	"errors"
+	"net"
+	"reflect"
 	"testing"
 	"time"
-	
-	// "github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
 )
 
 func TestCreate(t *testing.T) {
@@ -300,13 +303,19 @@ func TestCreateBootVolume(t *testing.T) {
 	mockClient, _ := NewClient("test", "1")
 
 	// Call the function with a mock saveCloudInitToFile
-	volumeIDs, err := createBootVolume(
+	volumeIDs, _, err := createBootVolume(
 		ctx,
 		mockClient,
+		nil,
 		"test-server",
-		"ubuntu",
-		[]string{"ssh-rsa AAA..."},
-		"data provided by kops",
+		resolveImage(ctx, "ubuntu-22-04"),
+		BootDiskSpec{},
+		cloudInitConfig{
+			Hostname: "test-server",
+			UserData: "data provided by kops",
+			SSHKeys:  []string{"ssh-rsa AAA..."},
+		},
+		"",
 	)
 	if err != nil {
 		t.Fatalf("createBootVolume returned error: %v", err)
@@ -323,3 +332,382 @@ func TestCreateBootVolume(t *testing.T) {
 		}
 	}
 }
+
+func TestBootVolumeOpts(t *testing.T) {
+	image := &Image{Name: "ubuntu-22-04", URL: "https://images.example.com/ubuntu-22-04.qcow2"}
+
+	opts := bootVolumeOpts("web-1", image, BootDiskSpec{Bus: DiskBusSCSI}, "key")
+	if opts.Name != "web-1-boot" || opts.Size != defaultBootDiskSize || opts.Bus != DiskBusSCSI || opts.Url != image.URL {
+		t.Errorf("unexpected boot volume options: %+v", opts)
+	}
+	if !opts.Private {
+		t.Errorf("expected the boot volume to be private by default")
+	}
+
+	if shared := bootVolumeOpts("web-1", image, BootDiskSpec{Shared: true}, ""); shared.Private {
+		t.Errorf("expected a shared boot volume not to be private")
+	}
+}
+
+func TestServerStatusFromString(t *testing.T) {
+	tests := map[string]ServerStatus{
+		"running":  ServerStatusRunning,
+		"Running":  ServerStatusRunning,
+		"shutoff":  ServerStatusOff,
+		"creating": ServerStatusInitializing,
+		"deleting": ServerStatusDeleting,
+		"":         ServerStatusUnknown,
+		"crashed":  ServerStatusUnknown,
+	}
+
+	for status, expected := range tests {
+		if got := ServerStatusFromString(status); got != expected {
+			t.Errorf("ServerStatusFromString(%q) = %q, want %q", status, got, expected)
+		}
+	}
+}
+
+func TestServerFromSchema(t *testing.T) {
+	ipv4 := "192.168.80.12"
+	created := time.Date(2025, 6, 12, 10, 0, 0, 0, time.UTC)
+	s := schema.Server{
+		UniqueID: "549e19f2-1d19-4a37-8f10-b8be2569339b",
+		Name:     "master-1",
+		Status:   "running",
+		Created:  created,
+		NetworkConfig: schema.NetworkConfig{
+			Interface: "ens3",
+			Source:    "test-network",
+			MAC:       "52:54:00:12:34:56",
+			IPv4:      &ipv4,
+		},
+		ServerURL: "https://51.159.157.254:7776",
+		IsGateway: true,
+		ReqJSON: schema.RequestConfig{
+			Slots:         2,
+			Overprovision: 2,
+			Arch:          "X86_64",
+			Flags:         []string{"sse2"},
+			RamSize:       2048,
+			OSFamily:      "linux",
+			OSFlavour:     "ubuntu",
+		},
+		Labels: map[string]string{"cluster": "test.k8s"},
+		Volumes: []schema.StorageVolume{
+			{VolumeID: "boot-volume-id", Name: "master-1-boot", Size: 50, Bootable: true},
+			{VolumeID: "cloudinit-volume-id", Name: "master-1-cloudinit", Cloudinit: true},
+			{VolumeID: "data-volume-id", Name: "master-1", Size: 20},
+		},
+	}
+
+	server := ServerFromSchema(s)
+
+	if server.Status != ServerStatusRunning {
+		t.Errorf("Status = %q, want %q", server.Status, ServerStatusRunning)
+	}
+	if server.PublicNet.IPv4 != ipv4 {
+		t.Errorf("PublicNet.IPv4 = %q, want %q", server.PublicNet.IPv4, ipv4)
+	}
+	if server.ServerType.Name != "neon" || server.ServerType.Cores != 2 || server.ServerType.Memory != 2 {
+		t.Errorf("unexpected ServerType: %+v", server.ServerType)
+	}
+	if server.ServerType.Architecture != ArchitectureX86_64 {
+		t.Errorf("Architecture = %q, want %q", server.ServerType.Architecture, ArchitectureX86_64)
+	}
+	if server.ServerType.Disk != 20 {
+		t.Errorf("Disk = %d, want 20", server.ServerType.Disk)
+	}
+	if server.Datacenter.Name != "51.159.157.254" {
+		t.Errorf("Datacenter.Name = %q, want %q", server.Datacenter.Name, "51.159.157.254")
+	}
+	if !server.IsGateway || server.ServerURL != s.ServerURL {
+		t.Errorf("IsGateway/ServerURL not mapped: %v %q", server.IsGateway, server.ServerURL)
+	}
+	if server.OSFlavour != "ubuntu" {
+		t.Errorf("OSFlavour = %q, want %q", server.OSFlavour, "ubuntu")
+	}
+	if len(server.PrivateNet) != 1 {
+		t.Fatalf("expected 1 private network, got %d", len(server.PrivateNet))
+	}
+	privateNet := server.PrivateNet[0]
+	if privateNet.Network.Name != "test-network" || privateNet.MACAddress != "52:54:00:12:34:56" || privateNet.Interface != "ens3" {
+		t.Errorf("unexpected private network: %+v", privateNet)
+	}
+	if privateNet.IP.String() != ipv4 {
+		t.Errorf("PrivateNet.IP = %s, want %s", privateNet.IP, ipv4)
+	}
+	if len(server.Volumes) != 3 || server.Volumes[0].Size != 50 || !server.Volumes[0].Bootable {
+		t.Errorf("volumes not fully mapped: %+v", server.Volumes)
+	}
+}
+
+func TestServerHasIP(t *testing.T) {
+	_, ipRange, _ := net.ParseCIDR("192.168.80.0/24")
+	_, otherRange, _ := net.ParseCIDR("10.0.0.0/16")
+
+	pending := &Server{}
+	assigned := &Server{
+		PublicNet: ServerPublicNet{IPv4: "192.168.80.12"},
+		PrivateNet: []ServerPrivateNet{
+			{IP: net.ParseIP("192.168.80.12")},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		server   *Server
+		network  *Network
+		expected bool
+	}{
+		{name: "No address yet", server: pending, expected: false},
+		{name: "Any address", server: assigned, expected: true},
+		{name: "Network without IP range", server: assigned, network: &Network{Name: "test-network"}, expected: true},
+		{name: "Address inside IP range", server: assigned, network: &Network{IPRange: ipRange}, expected: true},
+		{name: "Address outside IP range", server: assigned, network: &Network{IPRange: otherRange}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.server.hasIP(tt.network); got != tt.expected {
+				t.Errorf("hasIP() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServerStatusOverride(t *testing.T) {
+	client, _ := NewClient("test", "1")
+	serverClient := &ServerClient{client: client}
+	s := schema.Server{UniqueID: "id", Name: "node-1", Status: "running"}
+
+	client.setServerStatus("node-1", ServerStatusRebuilding)
+	if got := serverClient.fromSchema(s).Status; got != ServerStatusRebuilding {
+		t.Errorf("Status = %q, want %q", got, ServerStatusRebuilding)
+	}
+
+	client.clearServerStatus("node-1")
+	if got := serverClient.fromSchema(s).Status; got != ServerStatusRunning {
+		t.Errorf("Status = %q, want %q", got, ServerStatusRunning)
+	}
+}
+
+func TestRegisterRequestFromSchema(t *testing.T) {
+	client, _ := NewClient("test", "1")
+	serverClient := &ServerClient{client: client}
+	s := schema.Server{
+		UniqueID: "id",
+		Name:     "node-1",
+		ReqJSON: schema.RequestConfig{
+			Slots:         4,
+			Overprovision: 4,
+			Arch:          "X86_64",
+			RamSize:       4096,
+			OSFamily:      "linux",
+			OSFlavour:     "ubuntu",
+		},
+		Labels: map[string]string{
+			"cluster":     "test.k8s",
+			LabelProvider: "elemento",
+			LabelRegion:   "eu-south",
+		},
+		IsGateway: true,
+		Volumes: []schema.StorageVolume{
+			{VolumeID: "boot-volume-id", Name: "node-1-boot"},
+			{VolumeID: "data-volume-id", Name: "node-1", Bus: "scsi", Readonly: true},
+		},
+	}
+
+	reqBody, err := serverClient.registerRequestFromSchema(s)
+	if err != nil {
+		t.Fatalf("registerRequestFromSchema returned error: %v", err)
+	}
+	if reqBody.Info.Name != "node-1" || reqBody.Slots != 4 || reqBody.Ramsize != 4096 {
+		t.Errorf("unexpected request: %+v", reqBody)
+	}
+	if len(reqBody.Volumes) != 2 || reqBody.Volumes[1]["vid"] != "data-volume-id" {
+		t.Errorf("unexpected volumes: %v", reqBody.Volumes)
+	}
+	if len(reqBody.Volumes[0]) != 1 || reqBody.Volumes[1]["bus"] != "scsi" || reqBody.Volumes[1]["readonly"] != "true" {
+		t.Errorf("attachment options not kept: %v", reqBody.Volumes)
+	}
+	if reqBody.Provider != "elemento" || reqBody.Region != "eu-south" {
+		t.Errorf("placement not kept: provider %q region %q", reqBody.Provider, reqBody.Region)
+	}
+	if reqBody.Labels["cluster"] != "test.k8s" {
+		t.Errorf("labels not kept: %v", reqBody.Labels)
+	}
+	if !reqBody.IsGateway {
+		t.Errorf("gateway flag not kept")
+	}
+	if reqBody.Flags == nil || reqBody.Pci == nil {
+		t.Errorf("flags and pci must be empty lists, not null")
+	}
+}
+
+func TestRegisterNetworks(t *testing.T) {
+	s := schema.Server{
+		Name:          "node-1",
+		ReqJSON:       schema.RequestConfig{NetDevs: []string{"net-1", "private"}},
+		NetworkConfig: schema.NetworkConfig{Source: "virbr1"},
+	}
+	refs := serverNetworkRefs(s)
+	if !reflect.DeepEqual(refs, []string{"net-1", "private", "virbr1"}) {
+		t.Fatalf("serverNetworkRefs() = %v", refs)
+	}
+
+	networks := []schema.Network{
+		{NetworkID: "net-1", Name: "public", LibvirtNetwork: "virbr1"},
+		{NetworkID: "net-2", Name: "private", LibvirtNetwork: "virbr2"},
+	}
+	attachments, err := registerNetworks(s.Name, refs, networks)
+	if err != nil {
+		t.Fatalf("registerNetworks() returned error: %v", err)
+	}
+	want := []map[string]string{{"network_uid": "net-1"}, {"network_uid": "net-2"}}
+	if !reflect.DeepEqual(attachments, want) {
+		t.Errorf("registerNetworks() = %v, want %v", attachments, want)
+	}
+
+	if _, err := registerNetworks(s.Name, []string{"missing"}, networks); !IsError(err, ErrorCodeNotFound) {
+		t.Errorf("registerNetworks() = %v, want a not found error", err)
+	}
+}
+
+func TestCloneRegisterRequest(t *testing.T) {
+	original := schema.CreateComputeRequest{
+		Info:          schema.Info{Name: "node-1"},
+		Overprovision: 2,
+		Flags:         []string{"avx2"},
+		Volumes:       []map[string]string{{"vid": "boot-volume-id", "bus": "scsi"}},
+		Networks:      []map[string]string{{"network_uid": "net-id"}},
+		Labels:        map[string]string{"cluster": "test.k8s"},
+	}
+
+	clone := cloneRegisterRequest(original)
+	clone.Volumes[0]["bus"] = "virtio"
+	clone.Volumes = append(clone.Volumes, map[string]string{"vid": "data-volume-id"})
+	clone.Networks[0]["network_uid"] = "other-net-id"
+	clone.Flags[0] = "sse2"
+	clone.Labels["cluster"] = "other"
+
+	if len(original.Volumes) != 1 || original.Volumes[0]["bus"] != "scsi" {
+		t.Errorf("original volumes changed: %v", original.Volumes)
+	}
+	if original.Networks[0]["network_uid"] != "net-id" || original.Flags[0] != "avx2" || original.Labels["cluster"] != "test.k8s" {
+		t.Errorf("original request changed: %+v", original)
+	}
+	if clone.Overprovision != 2 || clone.Info.Name != "node-1" {
+		t.Errorf("unexpected clone: %+v", clone)
+	}
+}
+
+func TestResolveServerSize(t *testing.T) {
+	client, _ := NewClient("test", "1")
+	serverClient := &ServerClient{client: client}
+
+	tests := []struct {
+		name            string
+		serverType      *ServerType
+		expectedSlots   int
+		expectedRamsize int
+	}{
+		{
+			name:            "Explicit cores and memory",
+			serverType:      &ServerType{Name: "custom", Cores: 3, Memory: 1.5},
+			expectedSlots:   3,
+			expectedRamsize: 1536,
+		},
+		{
+			name:            "Size flavour",
+			serverType:      &ServerType{Name: "kripton"},
+			expectedSlots:   8,
+			expectedRamsize: 8192,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := serverClient.resolveServerSize(context.Background(), tt.serverType)
+			if err != nil {
+				t.Fatalf("resolveServerSize() unexpected error: %v", err)
+			}
+			if size.Slots != tt.expectedSlots || size.Ramsize != tt.expectedRamsize {
+				t.Errorf("resolveServerSize() = %+v, want %d slots and %d MB", size, tt.expectedSlots, tt.expectedRamsize)
+			}
+		})
+	}
+}
+
+func TestCreateManyCollectsErrors(t *testing.T) {
+	client, _ := NewClient("test", "1")
+	serverClient := &ServerClient{client: client}
+
+	// Invalid options fail before reaching the daemons
+	opts := []ServerCreateOpts{
+		{Name: ""},
+		{Name: "node-1"},
+		{Name: "node-2", ServerType: &ServerType{Name: "kripton"}},
+	}
+	results, err := serverClient.CreateMany(context.Background(), opts, BatchOpts{Concurrency: 2})
+	if err == nil {
+		t.Fatal("CreateMany() expected an error")
+	}
+	if len(results) != len(opts) {
+		t.Fatalf("CreateMany() returned %d results, want %d", len(results), len(opts))
+	}
+	for i, result := range results {
+		if result.Index != i {
+			t.Errorf("result %d has index %d", i, result.Index)
+		}
+		if result.Err == nil {
+			t.Errorf("result %d expected an error", i)
+		}
+	}
+}
+
+func TestCreateManyFailFast(t *testing.T) {
+	client, _ := NewClient("test", "1")
+	serverClient := &ServerClient{client: client}
+
+	opts := []ServerCreateOpts{{Name: ""}, {Name: ""}, {Name: ""}}
+	results, err := serverClient.CreateMany(context.Background(), opts, BatchOpts{Concurrency: 1, FailFast: true})
+	if err == nil {
+		t.Fatal("CreateMany() expected an error")
+	}
+	if errors.Is(results[0].Err, errCreationSkipped) {
+		t.Errorf("the first creation must run, got %v", results[0].Err)
+	}
+	for _, result := range results[1:] {
+		if !errors.Is(result.Err, errCreationSkipped) {
+			t.Errorf("result %d: expected the creation to be skipped, got %v", result.Index, result.Err)
+		}
+	}
+}
+
+func TestServerAttachedTo(t *testing.T) {
+	_, ipRange, _ := net.ParseCIDR("10.0.0.0/24")
+	server := &Server{
+		PrivateNet: []ServerPrivateNet{
+			{Network: &Network{Name: "cluster-net"}, IP: net.ParseIP("10.0.0.1")},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		network  *Network
+		expected bool
+	}{
+		{name: "Same name", network: &Network{ID: "net-id", Name: "cluster-net"}, expected: true},
+		{name: "IP in range", network: &Network{ID: "net-id", IPRange: ipRange}, expected: true},
+		{name: "Same libvirt name", network: &Network{ID: "net-id", Name: "cluster", LibvirtNetwork: "cluster-net"}, expected: true},
+		{name: "Other network", network: &Network{ID: "other-id", Name: "other-net"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := server.attachedTo(tt.network); got != tt.expected {
+				t.Errorf("attachedTo() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
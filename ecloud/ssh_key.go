@@ -11,6 +11,7 @@ import (
 	"encoding/pem"
 	"os"
 	"path/filepath"
+	"strings"
 
 	// "encoding/json"
 	"errors"
@@ -42,10 +43,33 @@ func (c *SSHKeyClient) All(ctx context.Context) ([]*SSHKey, error) {
 	return c.AllWithOpts(ctx, SSHKeyListOpts{})
 }
 
-// AllWithOpts returns all SSH keys with the given options.
+// AllWithOpts returns all SSH keys with the given options, from the keys saved
+// by Create.
 func (c *SSHKeyClient) AllWithOpts(ctx context.Context, opts SSHKeyListOpts) ([]*SSHKey, error) {
 	allSSHKeys := []*SSHKey{}
 
+	paths, err := filepath.Glob(filepath.Join(sshKeyDir, "*_public.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		publicKey, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		sshKey := &SSHKey{
+			Name:      strings.TrimSuffix(filepath.Base(path), "_public.txt"),
+			PublicKey: string(publicKey),
+		}
+		sshKey.Fingerprint, _ = sshKeyFingerprint(sshKey.PublicKey)
+		if opts.Name != "" && sshKey.Name != opts.Name {
+			continue
+		}
+		if opts.Fingerprint != "" && sshKey.Fingerprint != opts.Fingerprint {
+			continue
+		}
+		allSSHKeys = append(allSSHKeys, sshKey)
+	}
 	return allSSHKeys, nil
 }
 
@@ -87,7 +111,7 @@ func (c *SSHKeyClient) Create(ctx context.Context, opts SSHKeyCreateOpts) (*SSHK
 	}
 
 	// 2. Save keys to local .txt files
-	basePath := fmt.Sprintf("./ssh_keys/%s", opts.Name)
+	basePath := filepath.Join(sshKeyDir, opts.Name)
 	err = os.MkdirAll(filepath.Dir(basePath), 0700)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create directory: %w", err)
@@ -108,9 +132,28 @@ func (c *SSHKeyClient) Create(ctx context.Context, opts SSHKeyCreateOpts) (*SSHK
 		PublicKey: string(publicKey),
 		Labels:    opts.Labels,
 	}
+	sshKey.Fingerprint, _ = sshKeyFingerprint(sshKey.PublicKey)
 	return sshKey, &Response{}, nil
 }
 
+// sshKeyDir is the directory Create saves the keys to.
+const sshKeyDir = "./ssh_keys"
+
+// sshKeyFingerprint returns the SHA256 fingerprint of an authorized_keys line.
+func sshKeyFingerprint(publicKey string) (string, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return "", err
+	}
+	return ssh.FingerprintSHA256(key), nil
+}
+
+// isSSHKeyFingerprint reports whether ref is a fingerprint returned by
+// sshKeyFingerprint rather than a key name.
+func isSSHKeyFingerprint(ref string) bool {
+	return strings.HasPrefix(ref, "SHA256:")
+}
+
 func generateSSHKeyPair() ([]byte, []byte, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -4,10 +4,47 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
 )
 
+// Volume represents a volume in the Elemento Cloud.
+type Volume struct {
+	ID          string
+	Name        string
+	Status      VolumeStatus
+	Size        ByteSize // Provisioned size
+	SizeOnDisk  ByteSize // Space used on the storage host
+	Format      string
+	Bus         DiskBus
+	Alg         string
+	Bootable    bool
+	Readonly    bool
+	Shareable   bool
+	Private     bool
+	Clonable    bool
+	CloudInit   bool
+	Exported    bool
+	Own         bool // Whether the volume was created by the user of the client
+	CreatorID   string
+	LastUpdated time.Time
+	Datacenter  Datacenter
+	ServerURL   string    // URL of the host storing the volume
+	Servers     []*Server // Servers the volume is attached to, only their ID is set
+	Labels      map[string]string
+}
+
+// Attached reports whether the volume is attached to at least one server.
+func (v *Volume) Attached() bool {
+	return v.Status == VolumeStatusAttached
+}
+
 // VolumeStatus specifies a volume's status.
 type VolumeStatus string
 
@@ -17,6 +54,85 @@ const (
 
 	// VolumeStatusAvailable is the status when a volume is available.
 	VolumeStatusAvailable VolumeStatus = "available"
+
+	// VolumeStatusAttached is the status when a volume is attached to servers.
+	VolumeStatusAttached VolumeStatus = "attached"
+)
+
+// ByteSize is a size in bytes.
+type ByteSize int64
+
+const (
+	Byte     ByteSize = 1
+	Kilobyte          = 1024 * Byte
+	Megabyte          = 1024 * Kilobyte
+	Gigabyte          = 1024 * Megabyte
+	Terabyte          = 1024 * Gigabyte
+)
+
+// GB returns the size in gigabytes, the unit of the storage daemon.
+func (b ByteSize) GB() float64 {
+	return float64(b) / float64(Gigabyte)
+}
+
+// String returns the size in the largest unit it reaches, e.g. "1.5 GB".
+func (b ByteSize) String() string {
+	units := []struct {
+		size ByteSize
+		name string
+	}{{Terabyte, "TB"}, {Gigabyte, "GB"}, {Megabyte, "MB"}, {Kilobyte, "KB"}}
+	for _, unit := range units {
+		if b >= unit.size || -b >= unit.size {
+			value := math.Round(float64(b)/float64(unit.size)*100) / 100
+			return strconv.FormatFloat(value, 'f', -1, 64) + " " + unit.name
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + " B"
+}
+
+// ImageFormat specifies the disk format of an image imported into a volume.
+type ImageFormat string
+
+const (
+	// ImageFormatQCOW2 is the QEMU copy-on-write format of most cloud images.
+	ImageFormatQCOW2 ImageFormat = "qcow2"
+
+	// ImageFormatRaw is a plain disk image.
+	ImageFormatRaw ImageFormat = "raw"
+
+	// ImageFormatVMDK is the VMware virtual disk format.
+	ImageFormatVMDK ImageFormat = "vmdk"
+)
+
+// imageExtensions maps the extensions of image URLs to their format.
+// Cloud images distributed as .img are qcow2 images.
+var imageExtensions = map[string]ImageFormat{
+	".qcow2": ImageFormatQCOW2,
+	".qcow":  ImageFormatQCOW2,
+	".img":   ImageFormatQCOW2,
+	".raw":   ImageFormatRaw,
+	".vmdk":  ImageFormatVMDK,
+}
+
+// DetectImageFormat returns the format of the image at rawURL from its
+// extension, or an empty format if it is unknown.
+func DetectImageFormat(rawURL string) ImageFormat {
+	p := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		p = u.Path
+	}
+	return imageExtensions[strings.ToLower(path.Ext(p))]
+}
+
+// CloneAlg specifies how the storage daemon clones a volume.
+type CloneAlg string
+
+const (
+	// CloneAlgCopy clones the volume by copying it.
+	CloneAlgCopy CloneAlg = "cp"
+
+	// CloneAlgNone does not allow the volume to be cloned.
+	CloneAlgNone CloneAlg = "no"
 )
 
 // VolumeClient is a client for the volumes API.
@@ -25,17 +141,40 @@ type VolumeClient struct {
 }
 
 // GetByID retrieves a volume by its ID. If the volume does not exist, nil is returned.
-func (c *VolumeClient) GetByID(ctx context.Context, id string) (*schema.StorageVolume, error) {
-	reqBody := schema.GetStorageByIDRequest{
-		VolumeID: id,
-	}
-	resp, err := c.client.GetStorageByID(reqBody)
+func (c *VolumeClient) GetByID(ctx context.Context, id string) (*Volume, *Response, error) {
+	vol, err := c.getSchemaByID(id)
 	if err != nil {
-		return nil, err
+		if IsError(err, ErrorCodeNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
 	}
+	return VolumeFromSchema(*vol), &Response{}, nil
+}
 
-	// Return the volume from the response
-	return &resp.Volume, nil
+// GetByName retrieves a volume by its name. If the volume does not exist, nil is returned.
+func (c *VolumeClient) GetByName(ctx context.Context, name string) (*Volume, *Response, error) {
+	if name == "" {
+		return nil, nil, nil
+	}
+	volumes, response, err := c.List(ctx, VolumeListOpts{Name: name})
+	if len(volumes) == 0 {
+		return nil, response, err
+	}
+	return volumes[0], response, err
+}
+
+// getSchemaByID returns the volume with the given ID as reported by the storage daemon.
+func (c *VolumeClient) getSchemaByID(id string) (*schema.StorageVolume, error) {
+	resp, err := c.client.GetStorageByID(schema.GetStorageByIDRequest{VolumeID: id})
+	if err != nil {
+		return nil, notFoundError(err, fmt.Sprintf("volume %s not found", id))
+	}
+	vol := resp.Volume
+	if vol.VolumeID == "" {
+		vol.VolumeID = id
+	}
+	return &vol, nil
 }
 
 // VolumeCreateOpts specifies options for creating a new volume.
@@ -48,14 +187,76 @@ type VolumeCreateOpts struct {
 	Private   bool
 	Labels    map[string]string
 	Url       string
+
+	// Import options of a volume created from Url
+	Format   ImageFormat // Detected from the extension of Url if not set, qcow2 if unknown
+	Bus      DiskBus     // virtio if not set
+	Alg      CloneAlg    // cp if not set
+	Clonable *bool       // true if not set, unless Alg is CloneAlgNone
+
+	// Checksum of the image at Url, "sha256:<hex digest>" or "sha512:<hex digest>".
+	// If set, it is sent to the storage daemon and compared with the checksum
+	// the daemon reports for its download. A daemon that reports none leaves
+	// the image to be downloaded again and verified by the client, so the
+	// image at Url must not change in between: use versioned URLs. The volume
+	// is deleted and an error returned if the image does not match.
+	Checksum string
+
+	// IdempotencyKey enables the idempotency mode: an existing volume with the
+	// same name (and the same key, if labelled) is adopted instead of creating
+	// a second one.
+	IdempotencyKey string
 }
 
 // Create creates a new volume.
 func (c *VolumeClient) Create(ctx context.Context, opts VolumeCreateOpts) (string, *Response, error) {
+	volumeID, _, resp, err := c.ensure(ctx, opts)
+	return volumeID, resp, err
+}
+
+// ensure creates a volume, or adopts an existing one when opts.IdempotencyKey is set.
+// The returned bool reports whether the volume was created by this call.
+func (c *VolumeClient) ensure(ctx context.Context, opts VolumeCreateOpts) (string, bool, *Response, error) {
 	if err := opts.Validate(); err != nil {
-		return "", nil, err
+		return "", false, nil, err
+	}
+
+	if opts.IdempotencyKey != "" {
+		existing, err := c.findAdoptable(ctx, opts.Name, opts.IdempotencyKey)
+		if err != nil {
+			return "", false, nil, err
+		}
+		if existing != nil {
+			return existing.VolumeID, false, &Response{}, nil
+		}
 	}
 
+	volumeID, resp, err := c.create(ctx, opts)
+	return volumeID, err == nil, resp, err
+}
+
+// findAdoptable returns the volume named name that a create call using the
+// idempotency key may adopt, or nil if there is none.
+func (c *VolumeClient) findAdoptable(ctx context.Context, name string, key string) (*schema.StorageVolume, error) {
+	body, err := c.client.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+	for i := range *body {
+		vol := &(*body)[i]
+		if vol.Name != name {
+			continue
+		}
+		if err := checkIdempotencyKey("volume", name, vol.Labels, key); err != nil {
+			return nil, err
+		}
+		return vol, nil
+	}
+	return nil, nil
+}
+
+// create performs the volume creation without any idempotency lookup.
+func (c *VolumeClient) create(ctx context.Context, opts VolumeCreateOpts) (string, *Response, error) {
 	// Prepare the can create request
 	reqBodyCanCreate := schema.CanCreateStorageRequest{
 		Size: opts.Size,
@@ -68,65 +269,173 @@ func (c *VolumeClient) Create(ctx context.Context, opts VolumeCreateOpts) (strin
 	}
 
 	if opts.Url == "" {
-		reqBody := schema.CreateStorageRequest{
-			Name:      opts.Name,
-			Size:      opts.Size,
-			Bootable:  opts.Bootable,
-			Readonly:  opts.Readonly,
-			Shareable: opts.Shareable,
-			Private:   opts.Private,
-		}
-
 		// Create the storage volume
-		createdVolume, err := c.client.CreateStorage(reqBody)
+		createdVolume, err := c.client.CreateStorage(opts.storageRequest())
 		if err != nil {
 			return "", nil, fmt.Errorf("failed to create storage volume: %w", err)
 		}
 		return createdVolume.VolumeID, &Response{}, nil
 
 	} else {
-		reqBody := schema.CreateStorageImageRequest{
-			Name:     opts.Name,
-			Size:     opts.Size,
-			Alg:      "cp",
-			Format:   "qcow2",
-			Bus:      "virtio",
-			Clonable: true,
-			Private:  false,
-			Url:      opts.Url,
-		}
-
 		// Create the boot volume
-		createdVolume, err := c.client.CreateStorageImage(reqBody)
+		createdVolume, err := c.client.CreateStorageImage(opts.imageRequest())
 		if err != nil {
 			return "", nil, fmt.Errorf("failed to create storage volume: %w", err)
 		}
+		if opts.Checksum != "" {
+			if err := c.verifyImport(ctx, createdVolume.VolumeID, opts, createdVolume.Checksum); err != nil {
+				return "", nil, c.discard(createdVolume.VolumeID, err)
+			}
+		}
 
 		fmt.Printf("CreateStorageImage response: %+v\n", createdVolume)
 		return createdVolume.VolumeID, &Response{}, nil
 	}
 }
 
+// verifyImport verifies the image imported into the volume against
+// opts.Checksum, with the checksum reported by the storage daemon if it
+// computed one, otherwise by downloading and hashing the image at opts.Url.
+func (c *VolumeClient) verifyImport(ctx context.Context, volumeID string, opts VolumeCreateOpts, reported string) error {
+	if verified, err := checkImportedChecksum(volumeID, opts.Checksum, reported); verified || err != nil {
+		return err
+	}
+	if err := verifyURLChecksum(ctx, c.client.downloadClient(), opts.Url, opts.Checksum); err != nil {
+		return fmt.Errorf("volume %s: %w", volumeID, err)
+	}
+	return nil
+}
+
+// storageRequest returns the request creating an empty volume from opts.
+func (o VolumeCreateOpts) storageRequest() schema.CreateStorageRequest {
+	return schema.CreateStorageRequest{
+		Name:      o.Name,
+		Size:      o.Size,
+		Bootable:  o.Bootable,
+		Readonly:  o.Readonly,
+		Shareable: o.Shareable,
+		Private:   o.Private,
+		Labels:    idempotencyLabels(o.Labels, o.IdempotencyKey),
+	}
+}
+
+// imageRequest returns the request creating a volume from the image at opts.Url.
+func (o VolumeCreateOpts) imageRequest() schema.CreateStorageImageRequest {
+	format := o.Format
+	if format == "" {
+		format = DetectImageFormat(o.Url)
+	}
+	if format == "" {
+		format = ImageFormatQCOW2
+	}
+	bus := o.Bus
+	if bus == "" {
+		bus = DiskBusVirtio
+	}
+	alg := o.Alg
+	if alg == "" {
+		alg = CloneAlgCopy
+	}
+	clonable := alg != CloneAlgNone
+	if o.Clonable != nil {
+		clonable = *o.Clonable
+	}
+	checksum := o.Checksum
+	if c, err := parseChecksum(o.Checksum); err == nil {
+		checksum = c.String()
+	}
+	return schema.CreateStorageImageRequest{
+		Name:     o.Name,
+		Size:     o.Size,
+		Alg:      string(alg),
+		Format:   string(format),
+		Bus:      string(bus),
+		Clonable: clonable,
+		Private:  o.Private,
+		Url:      o.Url,
+		Checksum: checksum,
+		Labels:   idempotencyLabels(o.Labels, o.IdempotencyKey),
+	}
+}
+
 // CloudInitCreateOpts specifies options for creating a new cloud-init.
 type CloudInitCreateOpts struct {
-	Name string
+	Name   string
+	Labels map[string]string
+
+	// Root credentials, at least one is required by CreateCloudInit
+	SSHKeys      []*SSHKey    // Keys authorized for root
+	RootPassword SecretString // Root password, password login is disabled if empty
+
+	// IdempotencyKey enables the idempotency mode, see VolumeCreateOpts.
+	IdempotencyKey string
 }
 
+// CreateCloudInit creates the cloud-init volume of the server opts.Name,
+// embedding the userData script and authorizing opts.SSHKeys and
+// opts.RootPassword for root. Without either, root could never log in, so an
+// error is returned.
 func (c *VolumeClient) CreateCloudInit(ctx context.Context, opts CloudInitCreateOpts, userData string) (string, *Response, error) {
-	reqBody := schema.CreateStorageCloudInitRequest{
-		Name:          fmt.Sprintf("%s-cloudinit", opts.Name),
+	cfg := cloudInitConfig{Hostname: opts.Name, UserData: userData, SSHKeys: sshPublicKeys(opts.SSHKeys)}
+	if opts.RootPassword != "" {
+		hash, err := hashRootPassword(opts.RootPassword)
+		if err != nil {
+			return "", nil, err
+		}
+		cfg.PasswordHash = hash
+	}
+	if len(cfg.SSHKeys) == 0 && cfg.PasswordHash == "" {
+		return "", nil, Error{
+			Code:    ErrorCodeInvalidInput,
+			Message: fmt.Sprintf("cloud-init of %s needs SSH keys or a root password", opts.Name),
+		}
+	}
+
+	content := renderCloudInit(cfg)
+	volumeID, _, resp, err := c.ensureCloudInit(ctx, opts, content)
+	return volumeID, resp, err
+}
+
+// ensureCloudInit creates a cloud-init volume holding the rendered user-data
+// content, or adopts an existing one when opts.IdempotencyKey is set. The
+// returned bool reports whether the volume was created by this call.
+func (c *VolumeClient) ensureCloudInit(ctx context.Context, opts CloudInitCreateOpts, content string) (string, bool, *Response, error) {
+	name := opts.volumeName()
+
+	if opts.IdempotencyKey != "" {
+		existing, err := c.findAdoptable(ctx, name, opts.IdempotencyKey)
+		if err != nil {
+			return "", false, nil, err
+		}
+		if existing != nil {
+			return existing.VolumeID, false, &Response{}, nil
+		}
+	}
+
+	createdVolume, err := c.client.CreateStorageCloudInit(opts.request(), content)
+	if err != nil {
+		return "", false, nil, fmt.Errorf("failed to create cloud-init volume: %w", err)
+	}
+
+	return createdVolume.VolumeID, true, &Response{}, nil
+}
+
+// volumeName returns the name of the cloud-init volume of the server opts.Name.
+func (o CloudInitCreateOpts) volumeName() string {
+	return fmt.Sprintf("%s-cloudinit", o.Name)
+}
+
+// request returns the request creating the cloud-init volume described by opts.
+func (o CloudInitCreateOpts) request() schema.CreateStorageCloudInitRequest {
+	return schema.CreateStorageCloudInitRequest{
+		Name:          o.volumeName(),
 		Private:       false,
 		Bootable:      true,
 		Clonable:      false,
 		Alg:           "no",
 		ExpectedFiles: 2, // Minimum number of files accepted are 2
+		Labels:        idempotencyLabels(o.Labels, o.IdempotencyKey),
 	}
-	createdVolume, err := c.client.CreateStorageCloudInit(reqBody, userData)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to create cloud-init volume: %w", err)
-	}
-
-	return createdVolume.VolumeID, &Response{}, nil
 }
 
 func (c *VolumeClient) FeedFileIntoCloudInitStorage(ctx context.Context, volumeID string) (string, *Response, error) {
@@ -149,19 +458,191 @@ func (o VolumeCreateOpts) Validate() error {
 	if o.Size <= 0 {
 		return errors.New("size must be greater than 0")
 	}
+	switch o.Format {
+	case "", ImageFormatQCOW2, ImageFormatRaw, ImageFormatVMDK:
+	default:
+		return fmt.Errorf("unsupported image format %q", o.Format)
+	}
+	switch o.Bus {
+	case "", DiskBusVirtio, DiskBusSCSI, DiskBusSATA:
+	default:
+		return fmt.Errorf("unsupported bus %q", o.Bus)
+	}
+	switch o.Alg {
+	case "", CloneAlgCopy, CloneAlgNone:
+	default:
+		return fmt.Errorf("unsupported clone algorithm %q", o.Alg)
+	}
+	if o.Alg == CloneAlgNone && o.Clonable != nil && *o.Clonable {
+		return errors.New("a clonable volume needs a clone algorithm")
+	}
+	if o.Url == "" && (o.Format != "" || o.Bus != "" || o.Alg != "" || o.Clonable != nil || o.Checksum != "") {
+		return errors.New("format, bus, clone algorithm, clonability and checksum are only supported for volumes created from an image URL")
+	}
+	if o.Checksum != "" {
+		if _, err := parseChecksum(o.Checksum); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// VolumeListOpts specifies options for listing volumes.
+type VolumeListOpts struct {
+	ListOpts
+	Name      string
+	Bootable  *bool
+	Attached  *bool
+	Format    string
+	CloudInit *bool
+	Own       *bool
+}
+
+// matches reports whether vol matches the filters of opts, except the label selector.
+func (o VolumeListOpts) matches(vol schema.StorageVolume) bool {
+	if o.Name != "" && vol.Name != o.Name {
+		return false
+	}
+	if o.Bootable != nil && vol.Bootable != *o.Bootable {
+		return false
+	}
+	if o.Attached != nil && isAttached(vol) != *o.Attached {
+		return false
+	}
+	if o.Format != "" && !strings.EqualFold(vol.Format, o.Format) {
+		return false
+	}
+	if o.CloudInit != nil && vol.Cloudinit != *o.CloudInit {
+		return false
+	}
+	if o.Own != nil && vol.Own != *o.Own {
+		return false
+	}
+	return true
+}
+
 // List returns a list of volumes.
-func (c *VolumeClient) List(ctx context.Context) ([]*schema.StorageVolume, *Response, error) {
-	body, err := c.client.GetStorage()
+func (c *VolumeClient) List(ctx context.Context, opts VolumeListOpts) ([]*Volume, *Response, error) {
+	vols, err := c.list(opts)
 	if err != nil {
 		return nil, nil, err
 	}
+	volumes := make([]*Volume, len(vols))
+	for i, vol := range vols {
+		volumes[i] = VolumeFromSchema(*vol)
+	}
+	return volumes, &Response{}, nil
+}
+
+// list returns the volumes matching opts as reported by the storage daemon.
+func (c *VolumeClient) list(opts VolumeListOpts) ([]*schema.StorageVolume, error) {
+	selector, err := ParseLabelSelector(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.client.GetStorageWithOpts(opts.ListOpts)
+	if err != nil {
+		return nil, err
+	}
 
 	volumes := make([]*schema.StorageVolume, 0, len(*body))
-	for _, vol := range *body {
-		volumes = append(volumes, &vol)
+	for i := range *body {
+		vol := &(*body)[i]
+		if !opts.matches(*vol) || !selector.Matches(vol.Labels) {
+			continue
+		}
+		volumes = append(volumes, vol)
 	}
-	return volumes, &Response{}, nil
+	return volumes, nil
+}
+
+// VolumeDeleteOpts specifies options for deleting a volume.
+type VolumeDeleteOpts struct {
+	Force bool // Delete the volume even if it is attached to servers
+}
+
+// Delete deletes a volume. A volume still attached to servers is not deleted
+// unless opts.Force is set.
+func (c *VolumeClient) Delete(ctx context.Context, id string, opts VolumeDeleteOpts) (*Response, error) {
+	vol, err := c.getSchemaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.delete(vol, opts.Force)
+}
+
+func (c *VolumeClient) delete(vol *schema.StorageVolume, force bool) (*Response, error) {
+	if err := checkVolumeDetached(vol, force); err != nil {
+		return nil, err
+	}
+	if _, err := c.client.DeleteStorage(schema.DeleteStorageRequest{VolumeID: vol.VolumeID}); err != nil {
+		return nil, fmt.Errorf("failed to delete volume %s: %w", vol.VolumeID, err)
+	}
+	return &Response{}, nil
+}
+
+// checkVolumeDetached returns an error if vol is attached to servers, unless force is set.
+func checkVolumeDetached(vol *schema.StorageVolume, force bool) error {
+	if force || !isAttached(*vol) {
+		return nil
+	}
+	return Error{
+		Code:    ErrorCodeVolumeAlreadyAttached,
+		Message: fmt.Sprintf("volume %s is attached to %d server(s), detach it first or force the deletion", vol.VolumeID, max(vol.Nservers, len(vol.Servers))),
+	}
+}
+
+// VolumeDeleteManyOpts specifies options for deleting volumes in bulk.
+// At least one of LabelSelector and NamePrefix must be set.
+type VolumeDeleteManyOpts struct {
+	LabelSelector string // Label selector the volumes must match
+	NamePrefix    string // Prefix the volume names must start with
+	Force         bool   // Delete the volumes even if they are attached to servers
+	DryRun        bool   // Only return the volumes that would be deleted
+}
+
+// Validate checks if options are valid.
+func (o VolumeDeleteManyOpts) Validate() error {
+	if o.LabelSelector == "" && o.NamePrefix == "" {
+		return errors.New("missing label selector or name prefix")
+	}
+	return nil
+}
+
+// DeleteMany deletes the volumes matching opts, returning the deleted volumes
+// (or the volumes that would be deleted, in dry-run mode). Attached volumes
+// are skipped unless opts.Force is set; the errors of the skipped and failed
+// deletions are joined.
+func (c *VolumeClient) DeleteMany(ctx context.Context, opts VolumeDeleteManyOpts) ([]*Volume, *Response, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+	volumes, err := c.list(VolumeListOpts{ListOpts: ListOpts{LabelSelector: opts.LabelSelector}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deleted := []*Volume{}
+	var errs []error
+	for _, vol := range volumes {
+		if !strings.HasPrefix(vol.Name, opts.NamePrefix) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if opts.DryRun {
+			if err := checkVolumeDetached(vol, opts.Force); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		} else if _, err := c.delete(vol, opts.Force); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		deleted = append(deleted, VolumeFromSchema(*vol))
+	}
+	return deleted, &Response{}, errors.Join(errs...)
 }
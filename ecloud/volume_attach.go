@@ -0,0 +1,201 @@
+package ecloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// VolumeAttachOpts specifies options for attaching a volume to a server.
+type VolumeAttachOpts struct {
+	Bus      DiskBus // Bus the volume is attached to, chosen by the daemon if not set
+	ReadOnly bool
+
+	Interval time.Duration // Polling interval while waiting for the attachment, 2 seconds if not set
+	Timeout  time.Duration // Maximum waiting time, 2 minutes if not set
+}
+
+// Validate checks if options are valid.
+func (o VolumeAttachOpts) Validate() error {
+	switch o.Bus {
+	case "", DiskBusVirtio, DiskBusSCSI, DiskBusSATA:
+		return nil
+	default:
+		return fmt.Errorf("unsupported bus %q", o.Bus)
+	}
+}
+
+// VolumeDetachOpts specifies options for detaching a volume from a server.
+type VolumeDetachOpts struct {
+	Interval time.Duration // Polling interval while waiting for the detachment, 2 seconds if not set
+	Timeout  time.Duration // Maximum waiting time, 2 minutes if not set
+}
+
+// Attach attaches a volume to a server and waits until the server reports it.
+// The daemons only bind volumes at registration, so the server is registered
+// again with the volume added, keeping its volumes, networks and size. A volume
+// attached to another server is only attached again if it is shareable.
+func (c *VolumeClient) Attach(ctx context.Context, volume *Volume, server *Server, opts VolumeAttachOpts) (*Server, *Response, error) {
+	if volume == nil {
+		return nil, nil, errors.New("missing volume")
+	}
+	if server == nil {
+		return nil, nil, errors.New("missing server")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	vol, err := c.getSchemaByID(volume.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := c.client.Server.getSchemaByID(server.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkAttachable(vol, *current); err != nil {
+		return nil, nil, err
+	}
+
+	original, err := c.client.Server.registerRequestFromSchema(*current)
+	if err != nil {
+		return nil, nil, err
+	}
+	attachment := map[string]string{"vid": vol.VolumeID}
+	if opts.Bus != "" {
+		attachment["bus"] = string(opts.Bus)
+	}
+	if opts.ReadOnly {
+		attachment["readonly"] = strconv.FormatBool(opts.ReadOnly)
+	}
+
+	updated, err := c.client.Server.reregister(current, original, func(reqBody *schema.CreateComputeRequest) error {
+		reqBody.Volumes = append(reqBody.Volumes, attachment)
+		reqBody.Labels = withDetachedVolume(reqBody.Labels, vol.VolumeID, false)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.waitForVolume(ctx, updated.UniqueID, vol.VolumeID, true, opts.Interval, opts.Timeout)
+}
+
+// Detach detaches a volume from a server and waits until the server no longer
+// reports it. As for Attach, the server is registered again without the volume.
+// The boot and cloud-init volumes of the server cannot be detached. The volume
+// is listed in the LabelDetachedVolumes label of the server, so that it is not
+// collected as an orphan while the server exists.
+func (c *VolumeClient) Detach(ctx context.Context, volume *Volume, server *Server, opts VolumeDetachOpts) (*Server, *Response, error) {
+	if volume == nil {
+		return nil, nil, errors.New("missing volume")
+	}
+	if server == nil {
+		return nil, nil, errors.New("missing server")
+	}
+
+	current, err := c.client.Server.getSchemaByID(server.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasVolume(*current, volume.ID) {
+		return nil, nil, Error{
+			Code:    ErrorCodeNotFound,
+			Message: fmt.Sprintf("volume %s is not attached to server %s", volume.ID, server.Name),
+		}
+	}
+
+	for _, vol := range serverVolumes(*current) {
+		if vol.VolumeID == volume.ID && isSystemVolume(current.Name, vol) {
+			return nil, nil, Error{
+				Code:    ErrorCodeInvalidInput,
+				Message: fmt.Sprintf("volume %s is a system volume of server %s", vol.VolumeID, server.Name),
+			}
+		}
+	}
+
+	original, err := c.client.Server.registerRequestFromSchema(*current)
+	if err != nil {
+		return nil, nil, err
+	}
+	updated, err := c.client.Server.reregister(current, original, func(reqBody *schema.CreateComputeRequest) error {
+		reqBody.Volumes = withoutVolume(reqBody.Volumes, volume.ID)
+		reqBody.Labels = withDetachedVolume(reqBody.Labels, volume.ID, true)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.waitForVolume(ctx, updated.UniqueID, volume.ID, false, opts.Interval, opts.Timeout)
+}
+
+// waitForVolume waits until the server reports the volume as attached (or
+// detached) and returns the updated server.
+func (c *VolumeClient) waitForVolume(ctx context.Context, serverID, volumeID string, attached bool, interval, timeout time.Duration) (*Server, *Response, error) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		s, err := c.client.Server.getSchemaByID(serverID)
+		if err != nil && !IsError(err, ErrorCodeNotFound) {
+			return nil, nil, err
+		}
+		if s != nil && hasVolume(*s, volumeID) == attached {
+			return c.client.Server.fromSchema(*s), &Response{}, nil
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return nil, nil, fmt.Errorf("volume %s not reported by server %s: %w", volumeID, serverID, err)
+		}
+	}
+}
+
+// checkAttachable returns an error if vol cannot be attached to the VM
+// described by s, because it is already attached to it or, not being
+// shareable, to another server.
+func checkAttachable(vol *schema.StorageVolume, s schema.Server) error {
+	if hasVolume(s, vol.VolumeID) {
+		return Error{
+			Code:    ErrorCodeVolumeAlreadyAttached,
+			Message: fmt.Sprintf("volume %s is already attached to server %s", vol.VolumeID, s.Name),
+		}
+	}
+	if !vol.Shareable && isAttached(*vol) {
+		return Error{
+			Code:    ErrorCodeVolumeAlreadyAttached,
+			Message: fmt.Sprintf("volume %s is attached to another server and is not shareable", vol.VolumeID),
+		}
+	}
+	return nil
+}
+
+// withoutVolume returns the register volumes without the volume with the given ID.
+func withoutVolume(volumes []map[string]string, volumeID string) []map[string]string {
+	result := []map[string]string{}
+	for _, attachment := range volumes {
+		if attachment["vid"] != volumeID {
+			result = append(result, attachment)
+		}
+	}
+	return result
+}
+
+// hasVolume reports whether the VM described by s has the volume attached.
+func hasVolume(s schema.Server, volumeID string) bool {
+	for _, vol := range serverVolumes(s) {
+		if vol.VolumeID == volumeID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package ecloud
+
+import (
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestCheckAttachable(t *testing.T) {
+	server := schema.Server{
+		Name:    "web",
+		Volumes: []schema.StorageVolume{{VolumeID: "boot"}, {VolumeID: "data"}},
+	}
+
+	tests := []struct {
+		name    string
+		vol     *schema.StorageVolume
+		wantErr bool
+	}{
+		{name: "Detached", vol: &schema.StorageVolume{VolumeID: "extra"}},
+		{name: "Attached to the server", vol: &schema.StorageVolume{VolumeID: "data", Nservers: 1, Shareable: true}, wantErr: true},
+		{name: "Attached elsewhere", vol: &schema.StorageVolume{VolumeID: "extra", Nservers: 1}, wantErr: true},
+		{name: "Attached elsewhere, shareable", vol: &schema.StorageVolume{VolumeID: "extra", Nservers: 1, Shareable: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAttachable(tt.vol, server)
+			if tt.wantErr != IsError(err, ErrorCodeVolumeAlreadyAttached) {
+				t.Errorf("checkAttachable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithoutVolume(t *testing.T) {
+	volumes := []map[string]string{{"vid": "boot"}, {"vid": "data", "bus": "scsi"}, {"vid": "cloudinit"}}
+
+	got := withoutVolume(volumes, "data")
+	if len(got) != 2 || got[0]["vid"] != "boot" || got[1]["vid"] != "cloudinit" {
+		t.Errorf("withoutVolume() = %v", got)
+	}
+	if got := withoutVolume(volumes, "missing"); len(got) != 3 {
+		t.Errorf("withoutVolume() removed %d volumes, want 0", 3-len(got))
+	}
+}
+
+func TestVolumeAttachOptsValidate(t *testing.T) {
+	if err := (VolumeAttachOpts{Bus: DiskBusSCSI, ReadOnly: true}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (VolumeAttachOpts{Bus: "ide"}).Validate(); err == nil {
+		t.Errorf("expected an error for an unsupported bus")
+	}
+}
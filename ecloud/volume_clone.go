@@ -0,0 +1,248 @@
+package ecloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// CloneOpts specifies options for cloning a volume.
+type CloneOpts struct {
+	Name    string
+	Private bool
+	Labels  map[string]string
+}
+
+// Validate checks if options are valid.
+func (o CloneOpts) Validate() error {
+	if o.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+// Clone creates a copy of the volume src, with the clone algorithm of src.
+// The volume must be clonable; cloning an attached volume copies its content
+// as it is on the storage, without synchronizing the server's filesystems.
+//
+// Requires CapabilityVolumeClone, see WithCapabilities.
+func (c *VolumeClient) Clone(ctx context.Context, src *Volume, opts CloneOpts) (*Volume, *Response, error) {
+	if src == nil {
+		return nil, nil, errors.New("missing volume")
+	}
+	if err := c.client.requireCapability(CapabilityVolumeClone); err != nil {
+		return nil, nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	vol, err := c.getSchemaByID(src.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkClonable(vol); err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.client.CanCreateStorage(schema.CanCreateStorageRequest{Size: int(math.Ceil(vol.Size))}); err != nil {
+		return nil, nil, fmt.Errorf("volume %s cannot be cloned: %w", vol.VolumeID, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.client.CloneStorage(schema.CloneStorageRequest{
+		VolumeID: vol.VolumeID,
+		Name:     opts.Name,
+		Private:  opts.Private,
+		Labels:   mergeLabels(opts.Labels, map[string]string{LabelClonedFrom: vol.VolumeID}),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to clone volume %s: %w", vol.VolumeID, err)
+	}
+
+	clone, err := c.getSchemaByID(resp.VolumeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return VolumeFromSchema(*clone), &Response{}, nil
+}
+
+// checkClonable returns an error if vol cannot be cloned.
+func checkClonable(vol *schema.StorageVolume) error {
+	if !vol.Clonable || CloneAlg(vol.Alg) == CloneAlgNone {
+		return Error{
+			Code:    ErrorUnsupportedError,
+			Message: fmt.Sprintf("volume %s is not clonable", vol.VolumeID),
+		}
+	}
+	return nil
+}
+
+// Snapshot is a point-in-time copy of a volume: a private clone labelled with
+// the ID of its source volume and the time it was taken.
+type Snapshot struct {
+	Volume   *Volume
+	SourceID string
+	Created  time.Time
+}
+
+// SnapshotFromVolume returns the snapshot vol is, or nil if it is not a snapshot.
+func SnapshotFromVolume(vol *Volume) *Snapshot {
+	sourceID, ok := vol.Labels[LabelSnapshotOf]
+	if !ok {
+		return nil
+	}
+	snapshot := &Snapshot{Volume: vol, SourceID: sourceID}
+	if seconds, err := strconv.ParseInt(vol.Labels[LabelSnapshotTime], 10, 64); err == nil {
+		snapshot.Created = time.Unix(seconds, 0).UTC()
+	}
+	return snapshot
+}
+
+// SnapshotCreateOpts specifies options for creating a snapshot.
+type SnapshotCreateOpts struct {
+	Name   string // "<volume name>-snapshot-<Unix time>" if not set
+	Labels map[string]string
+}
+
+// CreateSnapshot takes a snapshot of the volume src, e.g. to back it up before
+// an upgrade. The snapshot is as consistent as the content of src on the
+// storage: stop the writes to an attached volume to take a consistent one.
+// If the daemon does not keep the snapshot labels on the new volume, it is
+// deleted and an error is returned, since it would not be listed as a snapshot.
+func (c *VolumeClient) CreateSnapshot(ctx context.Context, src *Volume, opts SnapshotCreateOpts) (*Snapshot, *Response, error) {
+	if src == nil {
+		return nil, nil, errors.New("missing volume")
+	}
+	now := time.Now().UTC()
+	name := opts.Name
+	if name == "" {
+		name = fmt.Sprintf("%s-snapshot-%d", src.Name, now.Unix())
+	}
+
+	vol, resp, err := c.Clone(ctx, src, CloneOpts{
+		Name:    name,
+		Private: true,
+		Labels:  mergeLabels(opts.Labels, snapshotLabels(src.ID, now)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// The labels are checked on the volume as read back from the daemon
+	if err := checkSnapshotLabels(vol, src.ID); err != nil {
+		return nil, nil, c.discard(vol.ID, err)
+	}
+	return SnapshotFromVolume(vol), resp, nil
+}
+
+// checkSnapshotLabels returns an error if vol is not labelled as a snapshot of
+// the volume sourceID.
+func checkSnapshotLabels(vol *Volume, sourceID string) error {
+	if vol.Labels[LabelSnapshotOf] != sourceID || vol.Labels[LabelSnapshotTime] == "" {
+		return Error{
+			Code:    ErrorUnsupportedError,
+			Message: fmt.Sprintf("volume %s was created without the snapshot labels of volume %s", vol.ID, sourceID),
+		}
+	}
+	return nil
+}
+
+// snapshotLabels returns the labels of a snapshot of the volume sourceID taken at t.
+func snapshotLabels(sourceID string, t time.Time) map[string]string {
+	return map[string]string{
+		LabelSnapshotOf:   sourceID,
+		LabelSnapshotTime: strconv.FormatInt(t.Unix(), 10),
+	}
+}
+
+// ListSnapshots returns the snapshots of the volume src, or all snapshots if
+// src is nil, the most recent first.
+func (c *VolumeClient) ListSnapshots(ctx context.Context, src *Volume) ([]*Snapshot, *Response, error) {
+	selector := LabelSnapshotOf
+	if src != nil {
+		selector = LabelSnapshotOf + "=" + src.ID
+	}
+	volumes, resp, err := c.List(ctx, VolumeListOpts{ListOpts: ListOpts{LabelSelector: selector}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, len(volumes))
+	for _, vol := range volumes {
+		snapshots = append(snapshots, SnapshotFromVolume(vol))
+	}
+	sortSnapshots(snapshots)
+	return snapshots, resp, nil
+}
+
+// sortSnapshots sorts snapshots by creation time, the most recent first.
+func sortSnapshots(snapshots []*Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.After(snapshots[j].Created)
+	})
+}
+
+// SnapshotRestoreOpts specifies options for restoring a snapshot.
+type SnapshotRestoreOpts struct {
+	Name    string // Name of the restored volume, the name of the source volume if not set
+	Private bool
+	Labels  map[string]string
+}
+
+// RestoreSnapshot creates a new volume from a snapshot, which is kept. Without
+// a name, the restored volume takes the name of the snapshot's source volume,
+// which must have been deleted first. Only snapshots named by CreateSnapshot
+// can be restored without a name.
+func (c *VolumeClient) RestoreSnapshot(ctx context.Context, snapshot *Snapshot, opts SnapshotRestoreOpts) (*Volume, *Response, error) {
+	if snapshot == nil || snapshot.Volume == nil {
+		return nil, nil, errors.New("missing snapshot")
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = snapshotSourceName(snapshot)
+		if name == "" {
+			return nil, nil, errors.New("missing name, the name of the source volume is unknown")
+		}
+		volumes, err := c.list(VolumeListOpts{})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, vol := range volumes {
+			if vol.VolumeID == snapshot.SourceID || vol.Name == name {
+				return nil, nil, Error{
+					Code:    ErrorCodeUniquenessError,
+					Message: fmt.Sprintf("volume %s still exists, delete it or restore the snapshot with another name", vol.Name),
+				}
+			}
+		}
+	}
+
+	return c.Clone(ctx, snapshot.Volume, CloneOpts{
+		Name:    name,
+		Private: opts.Private,
+		Labels:  opts.Labels,
+	})
+}
+
+// snapshotSourceName returns the name of the source volume of a snapshot named
+// by CreateSnapshot, or an empty string if the snapshot was named otherwise.
+func snapshotSourceName(snapshot *Snapshot) string {
+	suffix := "-snapshot-" + snapshot.Volume.Labels[LabelSnapshotTime]
+	name, ok := strings.CutSuffix(snapshot.Volume.Name, suffix)
+	if !ok {
+		return ""
+	}
+	return name
+}
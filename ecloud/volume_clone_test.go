@@ -0,0 +1,96 @@
+package ecloud
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestCheckClonable(t *testing.T) {
+	tests := []struct {
+		name    string
+		vol     *schema.StorageVolume
+		wantErr bool
+	}{
+		{name: "Clonable", vol: &schema.StorageVolume{VolumeID: "v1", Clonable: true, Alg: "cp"}},
+		{name: "Not clonable", vol: &schema.StorageVolume{VolumeID: "v1", Alg: "cp"}, wantErr: true},
+		{name: "No clone algorithm", vol: &schema.StorageVolume{VolumeID: "v1", Clonable: true, Alg: "no"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkClonable(tt.vol)
+			if tt.wantErr != IsError(err, ErrorUnsupportedError) {
+				t.Errorf("checkClonable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnapshotFromVolume(t *testing.T) {
+	taken := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	vol := &Volume{
+		ID:     "s1",
+		Name:   "etcd-main-snapshot-1740823200",
+		Labels: snapshotLabels("v1", taken),
+	}
+
+	snapshot := SnapshotFromVolume(vol)
+	if snapshot == nil {
+		t.Fatal("SnapshotFromVolume() = nil")
+	}
+	if snapshot.SourceID != "v1" || !snapshot.Created.Equal(taken) || snapshot.Volume != vol {
+		t.Errorf("unexpected snapshot: %+v", snapshot)
+	}
+	if name := snapshotSourceName(snapshot); name != "etcd-main" {
+		t.Errorf("snapshotSourceName() = %q, want etcd-main", name)
+	}
+
+	vol.Name = "before-upgrade"
+	if name := snapshotSourceName(snapshot); name != "" {
+		t.Errorf("snapshotSourceName() = %q, want empty name", name)
+	}
+
+	if snapshot := SnapshotFromVolume(&Volume{ID: "v1"}); snapshot != nil {
+		t.Errorf("SnapshotFromVolume() = %+v, want nil", snapshot)
+	}
+}
+
+func TestCheckSnapshotLabels(t *testing.T) {
+	taken := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{name: "Snapshot labels", labels: mergeLabels(map[string]string{"env": "prod"}, snapshotLabels("v1", taken))},
+		{name: "Missing labels", labels: map[string]string{"env": "prod"}, wantErr: true},
+		{name: "Other source", labels: snapshotLabels("v2", taken), wantErr: true},
+		{name: "Missing time", labels: map[string]string{LabelSnapshotOf: "v1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSnapshotLabels(&Volume{ID: "s1", Labels: tt.labels}, "v1")
+			if tt.wantErr != IsError(err, ErrorUnsupportedError) {
+				t.Errorf("checkSnapshotLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSortSnapshots(t *testing.T) {
+	base := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []*Snapshot{
+		{SourceID: "old", Created: base},
+		{SourceID: "new", Created: base.Add(2 * time.Hour)},
+		{SourceID: "mid", Created: base.Add(time.Hour)},
+	}
+
+	sortSnapshots(snapshots)
+	if snapshots[0].SourceID != "new" || snapshots[1].SourceID != "mid" || snapshots[2].SourceID != "old" {
+		t.Errorf("unexpected order: %s, %s, %s", snapshots[0].SourceID, snapshots[1].SourceID, snapshots[2].SourceID)
+	}
+}
@@ -0,0 +1,163 @@
+package ecloud
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// VolumeExport is an exported volume, whose image can be downloaded.
+type VolumeExport struct {
+	VolumeID string
+	URL      string
+	Format   ImageFormat
+	Size     ByteSize // Size of the image, 0 if unknown
+	Checksum string   // Checksum of the image as "<algorithm>:<hex digest>", empty if unknown
+}
+
+// Export exports a volume, making its image downloadable. The image of an
+// attached volume is not consistent unless the writes to it are stopped.
+//
+// Requires CapabilityVolumeExport, see WithCapabilities.
+func (c *VolumeClient) Export(ctx context.Context, id string) (*VolumeExport, *Response, error) {
+	if err := c.client.requireCapability(CapabilityVolumeExport); err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.client.ExportStorage(schema.ExportStorageRequest{VolumeID: id})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to export volume %s: %w", id, err)
+	}
+	return c.exportFromSchema(id, *resp), &Response{}, nil
+}
+
+// exportFromSchema converts the export response of the volume id, resolving
+// its URL against the storage daemon.
+func (c *VolumeClient) exportFromSchema(id string, resp schema.ExportStorageResponse) *VolumeExport {
+	export := &VolumeExport{
+		VolumeID: resp.VolumeID,
+		URL:      resp.URL,
+		Format:   ImageFormat(resp.Format),
+		Size:     ByteSize(resp.Size),
+		Checksum: resp.Checksum,
+	}
+	if export.VolumeID == "" {
+		export.VolumeID = id
+	}
+	if strings.HasPrefix(export.URL, "/") {
+		export.URL = c.client.endpoint + ":27777" + export.URL
+	}
+	return export
+}
+
+// DownloadOpts specifies options for downloading a volume.
+type DownloadOpts struct {
+	Progress func(DownloadProgress) // Called as the image is written, if set
+}
+
+// DownloadProgress reports the progress of a download.
+type DownloadProgress struct {
+	Received ByteSize
+	Total    ByteSize // 0 if unknown
+}
+
+// DownloadResult describes a downloaded volume image.
+type DownloadResult struct {
+	Export   *VolumeExport
+	Size     ByteSize
+	Checksum string // Checksum of the downloaded image, "sha256:<hex digest>" unless the daemon uses another algorithm
+}
+
+// Download exports a volume and writes its image to w. If the daemon reports
+// the checksum of the image, the download fails with ErrorCodeChecksumMismatch
+// if they differ; w has then received the corrupted image.
+func (c *VolumeClient) Download(ctx context.Context, id string, w io.Writer, opts DownloadOpts) (*DownloadResult, *Response, error) {
+	export, _, err := c.Export(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := downloadExport(ctx, c.client.downloadClient(), export, w, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, &Response{}, nil
+}
+
+// downloadExport writes the image of export to w, verifying its size and checksum if known.
+func downloadExport(ctx context.Context, httpClient *http.Client, export *VolumeExport, w io.Writer, opts DownloadOpts) (*DownloadResult, error) {
+	id := export.VolumeID
+	if export.URL == "" {
+		return nil, fmt.Errorf("volume %s was exported without a download URL", id)
+	}
+
+	expected := checksum{algorithm: "sha256"}
+	if export.Checksum != "" {
+		var err error
+		if expected, err = parseChecksum(export.Checksum); err != nil {
+			return nil, err
+		}
+	}
+	h, err := expected.newHash()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, export.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download volume %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(body)}
+	}
+
+	total := export.Size
+	if total == 0 && resp.ContentLength > 0 {
+		total = ByteSize(resp.ContentLength)
+	}
+	progress := &progressWriter{total: total, progress: opts.Progress}
+	n, err := io.Copy(io.MultiWriter(w, h, progress), resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download volume %s: %w", id, err)
+	}
+	if total > 0 && ByteSize(n) != total {
+		return nil, fmt.Errorf("downloaded %d bytes of volume %s, expected %d", n, id, int64(total))
+	}
+
+	result := &DownloadResult{
+		Export:   export,
+		Size:     ByteSize(n),
+		Checksum: checksum{algorithm: expected.algorithm, digest: hex.EncodeToString(h.Sum(nil))}.String(),
+	}
+	if expected.digest != "" && result.Checksum != expected.String() {
+		return nil, Error{
+			Code:    ErrorCodeChecksumMismatch,
+			Message: fmt.Sprintf("volume %s: expected %s, got %s", id, expected, result.Checksum),
+		}
+	}
+	return result, nil
+}
+
+// progressWriter reports the bytes written to it.
+type progressWriter struct {
+	received ByteSize
+	total    ByteSize
+	progress func(DownloadProgress)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.received += ByteSize(len(b))
+	if p.progress != nil {
+		p.progress(DownloadProgress{Received: p.received, Total: p.total})
+	}
+	return len(b), nil
+}
@@ -0,0 +1,65 @@
+package ecloud
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestExportFromSchema(t *testing.T) {
+	c := &VolumeClient{client: &Client{endpoint: "http://127.0.0.1"}}
+
+	export := c.exportFromSchema("v1", schema.ExportStorageResponse{URL: "/exports/v1.qcow2", Format: "qcow2", Size: 1024})
+	if export.VolumeID != "v1" || export.URL != "http://127.0.0.1:27777/exports/v1.qcow2" || export.Format != ImageFormatQCOW2 || export.Size != Kilobyte {
+		t.Errorf("unexpected export: %+v", export)
+	}
+
+	export = c.exportFromSchema("v1", schema.ExportStorageResponse{VolumeID: "v1", URL: "https://storage.example.com/v1.qcow2"})
+	if export.URL != "https://storage.example.com/v1.qcow2" {
+		t.Errorf("URL = %q, want the absolute URL", export.URL)
+	}
+}
+
+func TestDownloadExport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	var progress []DownloadProgress
+	var buf bytes.Buffer
+	result, err := downloadExport(ctx, server.Client(), &VolumeExport{VolumeID: "v1", URL: server.URL, Size: 5}, &buf, DownloadOpts{
+		Progress: func(p DownloadProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("downloadExport() error = %v", err)
+	}
+	if buf.String() != "hello" || result.Size != 5 || result.Checksum != helloSHA256 {
+		t.Errorf("unexpected result: %q, %+v", buf.String(), result)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != (DownloadProgress{Received: 5, Total: 5}) {
+		t.Errorf("unexpected progress: %v", progress)
+	}
+
+	result, err = downloadExport(ctx, server.Client(), &VolumeExport{VolumeID: "v1", URL: server.URL, Checksum: helloSHA512}, &bytes.Buffer{}, DownloadOpts{})
+	if err != nil || result.Checksum != helloSHA512 {
+		t.Errorf("downloadExport() = %+v, %v, want a verified SHA-512 checksum", result, err)
+	}
+
+	mismatch := "sha256:" + strings.Repeat("0", 64)
+	_, err = downloadExport(ctx, server.Client(), &VolumeExport{VolumeID: "v1", URL: server.URL, Checksum: mismatch}, &bytes.Buffer{}, DownloadOpts{})
+	if !IsError(err, ErrorCodeChecksumMismatch) {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+
+	_, err = downloadExport(ctx, server.Client(), &VolumeExport{VolumeID: "v1", URL: server.URL, Size: 10}, &bytes.Buffer{}, DownloadOpts{})
+	if err == nil {
+		t.Errorf("expected an error for a truncated download")
+	}
+}
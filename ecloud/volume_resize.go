@@ -0,0 +1,231 @@
+package ecloud
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+	"golang.org/x/crypto/ssh"
+)
+
+// VolumeResizeOpts specifies options for resizing a volume.
+type VolumeResizeOpts struct {
+	// GrowFilesystem grows the first partition of the volume and its
+	// filesystem on the server the volume is attached to, if set
+	GrowFilesystem *FilesystemGrowOpts
+}
+
+// FilesystemGrowOpts specifies how to reach a server over SSH to grow the
+// filesystem of a resized volume.
+type FilesystemGrowOpts struct {
+	Server          *Server
+	User            string // root if not set, other users need passwordless sudo
+	PrivateKey      []byte // PEM encoded private key, e.g. as saved by SSHKeyClient.Create
+	HostKeyCallback ssh.HostKeyCallback
+	Port            int           // 22 if not set
+	Timeout         time.Duration // Timeout of the SSH connection, 30 seconds if not set
+}
+
+// Validate checks if options are valid.
+func (o FilesystemGrowOpts) Validate() error {
+	if o.Server == nil {
+		return errors.New("missing server")
+	}
+	if len(o.PrivateKey) == 0 {
+		return errors.New("missing private key")
+	}
+	if o.HostKeyCallback == nil {
+		return errors.New("missing host key callback")
+	}
+	return nil
+}
+
+// Resize grows a volume to size GB. Volumes cannot be shrunk.
+//
+// Requires CapabilityVolumeResize, see WithCapabilities.
+func (c *VolumeClient) Resize(ctx context.Context, volume *Volume, size int, opts VolumeResizeOpts) (*Volume, *Response, error) {
+	if volume == nil {
+		return nil, nil, errors.New("missing volume")
+	}
+	if err := c.client.requireCapability(CapabilityVolumeResize); err != nil {
+		return nil, nil, err
+	}
+	if opts.GrowFilesystem != nil {
+		if err := opts.GrowFilesystem.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	vol, err := c.getSchemaByID(volume.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkResize(vol, size); err != nil {
+		return nil, nil, err
+	}
+
+	// Find the device before resizing, so that nothing is done if it is not attached
+	var device string
+	if opts.GrowFilesystem != nil {
+		current, err := c.client.Server.getSchemaByID(opts.GrowFilesystem.Server.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if device, err = volumeDevice(*current, vol.VolumeID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if _, err := c.client.CanCreateStorage(schema.CanCreateStorageRequest{Size: storageGrowth(vol, size)}); err != nil {
+		return nil, nil, fmt.Errorf("volume %s cannot be grown to %d GB: %w", vol.VolumeID, size, err)
+	}
+	if _, err := c.client.ResizeStorage(schema.ResizeStorageRequest{VolumeID: vol.VolumeID, Size: size}); err != nil {
+		return nil, nil, fmt.Errorf("failed to resize volume %s: %w", vol.VolumeID, err)
+	}
+
+	if opts.GrowFilesystem != nil {
+		if err := growFilesystem(ctx, *opts.GrowFilesystem, device); err != nil {
+			return nil, nil, fmt.Errorf("volume %s resized, but its filesystem was not grown: %w", vol.VolumeID, err)
+		}
+	}
+
+	resized, err := c.getSchemaByID(vol.VolumeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return VolumeFromSchema(*resized), &Response{}, nil
+}
+
+// checkResize returns an error if vol cannot be resized to size GB.
+func checkResize(vol *schema.StorageVolume, size int) error {
+	if float64(size) <= vol.Size {
+		return Error{
+			Code:    ErrorCodeInvalidInput,
+			Message: fmt.Sprintf("volume %s can only grow, from %g GB", vol.VolumeID, vol.Size),
+		}
+	}
+	return nil
+}
+
+// storageGrowth returns the GB of storage needed to grow vol to size GB,
+// rounded up so that a growth of less than 1 GB is still checked.
+func storageGrowth(vol *schema.StorageVolume, size int) int {
+	return int(math.Ceil(float64(size) - vol.Size))
+}
+
+// volumeDevice returns the device of the volume in the VM described by s,
+// e.g. "/dev/vdb". Devices are named in attach order by bus, the cloud-init
+// volume being a CD-ROM.
+func volumeDevice(s schema.Server, volumeID string) (string, error) {
+	indexes := map[string]int{}
+	for _, vol := range serverVolumes(s) {
+		if vol.Cloudinit {
+			continue
+		}
+		bus := DiskBus(vol.Bus)
+		if bus == "" {
+			bus = DiskBusVirtio
+		}
+		name := deviceName(bus, 0)
+		prefix := name[:len(name)-1]
+		if vol.VolumeID == volumeID {
+			return "/dev/" + deviceName(bus, indexes[prefix]), nil
+		}
+		indexes[prefix]++
+	}
+	return "", Error{
+		Code:    ErrorCodeNotFound,
+		Message: fmt.Sprintf("volume %s is not attached to server %s", volumeID, s.Name),
+	}
+}
+
+// growFilesystemScript returns the shell script growing the first partition
+// of device, or the device itself if not partitioned, and its filesystem.
+func growFilesystemScript(device string) string {
+	name := strings.TrimPrefix(device, "/dev/")
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("if [ -w /sys/class/block/%s/device/rescan ]; then echo 1 > /sys/class/block/%s/device/rescan; fi", name, name),
+		fmt.Sprintf("part=%s1", device),
+		fmt.Sprintf("if [ -b \"$part\" ]; then growpart %s 1 || [ $? -eq 1 ]; else part=%s; fi", device, device),
+		"fstype=$(lsblk -no FSTYPE \"$part\")",
+		"case \"$fstype\" in",
+		"ext*) resize2fs \"$part\" ;;",
+		"xfs) xfs_growfs \"$(findmnt -no TARGET \"$part\")\" ;;",
+		"btrfs) btrfs filesystem resize max \"$(findmnt -no TARGET \"$part\")\" ;;",
+		"*) echo \"unsupported filesystem $fstype\" >&2; exit 1 ;;",
+		"esac",
+	}, "\n") + "\n"
+}
+
+// growFilesystem runs growFilesystemScript on the server over SSH.
+func growFilesystem(ctx context.Context, opts FilesystemGrowOpts, device string) error {
+	signer, err := ssh.ParsePrivateKey(opts.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	user := opts.User
+	if user == "" {
+		user = "root"
+	}
+	port := opts.Port
+	if port == 0 {
+		port = 22
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ip := parseIP(opts.Server.PublicNet.IPv4)
+	if ip == nil {
+		return fmt.Errorf("server %s has no IP address", opts.Server.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: opts.HostKeyCallback,
+	})
+	if err != nil {
+		return err
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	command := "sh -s"
+	if user != "root" {
+		command = "sudo -n sh -s"
+	}
+	var stderr bytes.Buffer
+	session.Stdin = strings.NewReader(growFilesystemScript(device))
+	session.Stderr = &stderr
+	if err := session.Run(command); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
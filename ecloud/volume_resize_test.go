@@ -0,0 +1,99 @@
+package ecloud
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestCheckResize(t *testing.T) {
+	vol := &schema.StorageVolume{VolumeID: "v1", Size: 10}
+
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{name: "Grow", size: 20},
+		{name: "Same size", size: 10, wantErr: true},
+		{name: "Shrink", size: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkResize(vol, tt.size)
+			if tt.wantErr != IsError(err, ErrorCodeInvalidInput) {
+				t.Errorf("checkResize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStorageGrowth(t *testing.T) {
+	tests := []struct {
+		name     string
+		volSize  float64
+		size     int
+		expected int
+	}{
+		{name: "Whole GB", volSize: 10, size: 20, expected: 10},
+		{name: "Fraction of a GB", volSize: 9.5, size: 10, expected: 1},
+		{name: "Fractional volume", volSize: 9.5, size: 12, expected: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vol := &schema.StorageVolume{VolumeID: "v1", Size: tt.volSize}
+			if got := storageGrowth(vol, tt.size); got != tt.expected {
+				t.Errorf("storageGrowth() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVolumeDevice(t *testing.T) {
+	server := schema.Server{
+		Name: "etcd-0",
+		Volumes: []schema.StorageVolume{
+			{VolumeID: "boot", Bus: "virtio"},
+			{VolumeID: "cloudinit", Cloudinit: true},
+			{VolumeID: "data", Bus: "virtio"},
+			{VolumeID: "scsi", Bus: "scsi"},
+		},
+	}
+
+	tests := []struct {
+		volumeID string
+		want     string
+	}{
+		{volumeID: "boot", want: "/dev/vda"},
+		{volumeID: "data", want: "/dev/vdb"},
+		{volumeID: "scsi", want: "/dev/sda"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.volumeID, func(t *testing.T) {
+			got, err := volumeDevice(server, tt.volumeID)
+			if err != nil {
+				t.Fatalf("volumeDevice() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("volumeDevice() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := volumeDevice(server, "missing"); !IsError(err, ErrorCodeNotFound) {
+		t.Errorf("volumeDevice() error = %v, want not found", err)
+	}
+}
+
+func TestGrowFilesystemScript(t *testing.T) {
+	script := growFilesystemScript("/dev/vdb")
+	for _, want := range []string{"/sys/class/block/vdb/device/rescan", "growpart /dev/vdb 1", "resize2fs", "xfs_growfs"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %q:\n%s", want, script)
+		}
+	}
+}
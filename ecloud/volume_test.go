@@ -2,8 +2,11 @@ package ecloud
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
 )
 
 func TestCreateVolumeWithUrl(t *testing.T) {
@@ -79,7 +82,8 @@ func TestCreateCloudInit(t *testing.T) {
 		{
 			name: "basic_cloudinit",
 			opts: CloudInitCreateOpts{
-				Name: "test-cloudinit",
+				Name:    "test-cloudinit",
+				SSHKeys: []*SSHKey{{Name: "test-key", PublicKey: "ssh-ed25519 AAAAC3Nza test@host"}},
 			},
 			description: "Basic cloud-init volume creation",
 		},
@@ -165,7 +169,8 @@ func TestFeedFileIntoCloudInitStorage(t *testing.T) {
 	// First, we need to create a cloud-init volume to feed files into
 	t.Log("Step 3: Creating a cloud-init volume for testing...")
 	cloudInitOpts := CloudInitCreateOpts{
-		Name: "test-cloudinit-complete",
+		Name:    "test-cloudinit-complete",
+		SSHKeys: []*SSHKey{{Name: "test-key", PublicKey: "ssh-ed25519 AAAAC3Nza test@host"}},
 	}
 
 	userData := `#cloud-config...`
@@ -262,3 +267,200 @@ func TestFeedFileIntoCloudInitStorage(t *testing.T) {
 
 	t.Log("=== Detailed FeedFileIntoCloudInitStorage test completed ===")
 }
+
+func TestCheckVolumeDetached(t *testing.T) {
+	tests := []struct {
+		name    string
+		vol     *schema.StorageVolume
+		force   bool
+		wantErr bool
+	}{
+		{name: "Detached", vol: &schema.StorageVolume{VolumeID: "v1"}},
+		{name: "Attached", vol: &schema.StorageVolume{VolumeID: "v1", Nservers: 1}, wantErr: true},
+		{name: "Attached, servers only", vol: &schema.StorageVolume{VolumeID: "v1", Servers: []string{"s1"}}, wantErr: true},
+		{name: "Attached and forced", vol: &schema.StorageVolume{VolumeID: "v1", Nservers: 1}, force: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVolumeDetached(tt.vol, tt.force)
+			if tt.wantErr != IsError(err, ErrorCodeVolumeAlreadyAttached) {
+				t.Errorf("checkVolumeDetached() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVolumeDeleteManyOptsValidate(t *testing.T) {
+	if err := (VolumeDeleteManyOpts{}).Validate(); err == nil {
+		t.Errorf("expected an error without label selector nor name prefix")
+	}
+	if err := (VolumeDeleteManyOpts{NamePrefix: "etcd-"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVolumeFromSchema(t *testing.T) {
+	vol := VolumeFromSchema(schema.StorageVolume{
+		VolumeID:    "v1",
+		Name:        "etcd-main",
+		Size:        1.5,
+		SizeOnDisk:  1048576,
+		Bus:         "virtio",
+		LastUpdated: "2025-03-01T10:20:30Z",
+		ServerUrl:   "https://storage1.example.com:27777",
+		Nservers:    1,
+		Servers:     []string{"s1"},
+	})
+
+	if vol.ID != "v1" || vol.Name != "etcd-main" {
+		t.Errorf("unexpected ID or name: %s, %s", vol.ID, vol.Name)
+	}
+	if vol.Size != 1536*Megabyte {
+		t.Errorf("Size = %v, want 1.5 GB", vol.Size)
+	}
+	if vol.SizeOnDisk != Megabyte {
+		t.Errorf("SizeOnDisk = %v, want 1 MB", vol.SizeOnDisk)
+	}
+	if vol.Bus != DiskBusVirtio {
+		t.Errorf("Bus = %q, want virtio", vol.Bus)
+	}
+	if !vol.LastUpdated.Equal(time.Date(2025, 3, 1, 10, 20, 30, 0, time.UTC)) {
+		t.Errorf("LastUpdated = %v", vol.LastUpdated)
+	}
+	if vol.Datacenter.Name != "storage1.example.com" {
+		t.Errorf("Datacenter.Name = %q", vol.Datacenter.Name)
+	}
+	if vol.Status != VolumeStatusAttached || !vol.Attached() {
+		t.Errorf("Status = %q, want attached", vol.Status)
+	}
+	if len(vol.Servers) != 1 || vol.Servers[0].ID != "s1" {
+		t.Errorf("Servers = %v, want [s1]", vol.Servers)
+	}
+
+	if vol := VolumeFromSchema(schema.StorageVolume{VolumeID: "v2"}); vol.Status != VolumeStatusAvailable {
+		t.Errorf("Status = %q, want available", vol.Status)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2025, 3, 1, 10, 20, 30, 0, time.UTC)
+	for _, s := range []string{"2025-03-01T10:20:30Z", "2025-03-01 10:20:30", "2025-03-01T10:20:30.000000", "1740824430"} {
+		if got := parseTimestamp(s); !got.Equal(want) {
+			t.Errorf("parseTimestamp(%q) = %v, want %v", s, got, want)
+		}
+	}
+	if got := parseTimestamp("yesterday"); !got.IsZero() {
+		t.Errorf("parseTimestamp() = %v, want zero time", got)
+	}
+}
+
+func TestVolumeListOptsMatches(t *testing.T) {
+	yes, no := true, false
+	vol := schema.StorageVolume{Name: "etcd-main", Bootable: false, Format: "qcow2", Own: true, Nservers: 1}
+
+	tests := []struct {
+		name string
+		opts VolumeListOpts
+		want bool
+	}{
+		{name: "No filters", opts: VolumeListOpts{}, want: true},
+		{name: "Name", opts: VolumeListOpts{Name: "etcd-main"}, want: true},
+		{name: "Other name", opts: VolumeListOpts{Name: "etcd-events"}, want: false},
+		{name: "Not bootable", opts: VolumeListOpts{Bootable: &no}, want: true},
+		{name: "Bootable", opts: VolumeListOpts{Bootable: &yes}, want: false},
+		{name: "Attached", opts: VolumeListOpts{Attached: &yes}, want: true},
+		{name: "Detached", opts: VolumeListOpts{Attached: &no}, want: false},
+		{name: "Format", opts: VolumeListOpts{Format: "QCOW2"}, want: true},
+		{name: "Other format", opts: VolumeListOpts{Format: "raw"}, want: false},
+		{name: "Cloud-init", opts: VolumeListOpts{CloudInit: &yes}, want: false},
+		{name: "Own", opts: VolumeListOpts{Own: &yes}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.matches(vol); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		size ByteSize
+		want string
+	}{
+		{size: 512, want: "512 B"},
+		{size: 1536 * Megabyte, want: "1.5 GB"},
+		{size: 10 * Gigabyte, want: "10 GB"},
+		{size: 2 * Terabyte, want: "2 TB"},
+	}
+	for _, tt := range tests {
+		if got := tt.size.String(); got != tt.want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(tt.size), got, tt.want)
+		}
+	}
+}
+
+func TestDetectImageFormat(t *testing.T) {
+	tests := []struct {
+		url  string
+		want ImageFormat
+	}{
+		{url: "https://cloud-images.ubuntu.com/jammy/current/jammy-server-cloudimg-amd64.img", want: ImageFormatQCOW2},
+		{url: "https://example.com/images/debian-12.QCOW2?token=abc", want: ImageFormatQCOW2},
+		{url: "https://example.com/images/appliance.vmdk", want: ImageFormatVMDK},
+		{url: "https://example.com/images/disk.raw", want: ImageFormatRaw},
+		{url: "https://example.com/images/disk.iso", want: ""},
+	}
+	for _, tt := range tests {
+		if got := DetectImageFormat(tt.url); got != tt.want {
+			t.Errorf("DetectImageFormat(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestVolumeCreateOptsValidateImport(t *testing.T) {
+	yes := true
+	url := "https://example.com/disk.raw"
+
+	tests := []struct {
+		name    string
+		opts    VolumeCreateOpts
+		wantErr bool
+	}{
+		{name: "Import options", opts: VolumeCreateOpts{Name: "v", Size: 10, Url: url, Format: ImageFormatRaw, Bus: DiskBusSATA, Alg: CloneAlgCopy, Clonable: &yes}},
+		{name: "Unsupported format", opts: VolumeCreateOpts{Name: "v", Size: 10, Url: url, Format: "vdi"}, wantErr: true},
+		{name: "Unsupported bus", opts: VolumeCreateOpts{Name: "v", Size: 10, Url: url, Bus: "ide"}, wantErr: true},
+		{name: "Unsupported algorithm", opts: VolumeCreateOpts{Name: "v", Size: 10, Url: url, Alg: "rsync"}, wantErr: true},
+		{name: "Clonable without algorithm", opts: VolumeCreateOpts{Name: "v", Size: 10, Url: url, Alg: CloneAlgNone, Clonable: &yes}, wantErr: true},
+		{name: "Import options without URL", opts: VolumeCreateOpts{Name: "v", Size: 10, Format: ImageFormatRaw}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVolumeCreateOptsImageRequest(t *testing.T) {
+	req := VolumeCreateOpts{Name: "v", Size: 10, Url: "https://example.com/disk.vmdk", Private: true}.imageRequest()
+	if req.Format != "vmdk" || req.Bus != "virtio" || req.Alg != "cp" || !req.Clonable || !req.Private {
+		t.Errorf("unexpected request with defaults: %+v", req)
+	}
+
+	req = VolumeCreateOpts{Name: "v", Size: 10, Url: "https://example.com/disk", Alg: CloneAlgNone}.imageRequest()
+	if req.Format != "qcow2" || req.Alg != "no" || req.Clonable || req.Checksum != "" {
+		t.Errorf("unexpected request without clone algorithm: %+v", req)
+	}
+
+	// The daemon verifies the image against the normalized checksum
+	req = VolumeCreateOpts{Name: "v", Size: 10, Url: "https://example.com/disk.img", Checksum: strings.ToUpper(helloSHA256)}.imageRequest()
+	if req.Checksum != helloSHA256 {
+		t.Errorf("Checksum = %q, want %q", req.Checksum, helloSHA256)
+	}
+}
@@ -0,0 +1,320 @@
+package ecloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+// defaultUploadChunkSize is the size of the uploaded chunks if not set.
+const defaultUploadChunkSize = 8 * Megabyte
+
+// UploadOpts specifies options for uploading an image into a new volume.
+type UploadOpts struct {
+	Size       ByteSize    // Size of the image read, required to split it in chunks
+	Format     ImageFormat // qcow2 or raw, qcow2 if not set
+	VolumeSize int         // Size of the volume in GB, the image size rounded up if not set
+	Bus        DiskBus     // virtio if not set
+	Private    bool
+	Labels     map[string]string
+
+	ChunkSize ByteSize             // 8 MB if not set
+	Retries   int                  // Attempts to send a chunk again after a failure, 3 if not set
+	Progress  func(UploadProgress) // Called after each chunk is sent, if set
+
+	// Resumable keeps the volume of a failed upload, so that it can be resumed
+	// from the UploadError returned. The volume is deleted if not set.
+	Resumable bool
+	// Resume continues a failed upload into its volume, r must then read the
+	// image from Resume.Offset on. The other options must be the same as in
+	// the failed call.
+	Resume *UploadCheckpoint
+}
+
+// UploadCheckpoint is the progress of a failed upload, from which it can be resumed.
+type UploadCheckpoint struct {
+	VolumeID string
+	Offset   ByteSize // Bytes of the image received by the volume
+}
+
+// UploadError is returned when an upload fails after its volume was created.
+type UploadError struct {
+	UploadCheckpoint
+	Kept bool // Whether the volume was kept to resume the upload, see UploadOpts.Resumable
+	Err  error
+}
+
+func (e *UploadError) Error() string {
+	if e.Kept {
+		return fmt.Sprintf("upload into volume %s failed at byte %d, it can be resumed: %v", e.VolumeID, int64(e.Offset), e.Err)
+	}
+	return fmt.Sprintf("upload into volume %s failed at byte %d: %v", e.VolumeID, int64(e.Offset), e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// UploadProgress reports the progress of an upload.
+type UploadProgress struct {
+	Sent  ByteSize
+	Total ByteSize
+}
+
+// Validate checks if options are valid.
+func (o UploadOpts) Validate() error {
+	if o.Size <= 0 {
+		return errors.New("image size must be greater than 0")
+	}
+	switch o.Format {
+	case "", ImageFormatQCOW2, ImageFormatRaw:
+	default:
+		return fmt.Errorf("unsupported upload format %q", o.Format)
+	}
+	if o.VolumeSize < 0 {
+		return errors.New("volume size must not be negative")
+	}
+	if o.VolumeSize > 0 && o.Format == ImageFormatRaw && ByteSize(o.VolumeSize)*Gigabyte < o.Size {
+		return fmt.Errorf("volume size %d GB is smaller than the raw image (%s)", o.VolumeSize, o.Size)
+	}
+	switch o.Bus {
+	case "", DiskBusVirtio, DiskBusSCSI, DiskBusSATA:
+	default:
+		return fmt.Errorf("unsupported bus %q", o.Bus)
+	}
+	if o.ChunkSize < 0 || o.Retries < 0 {
+		return errors.New("chunk size and retries must not be negative")
+	}
+	if o.Resume != nil {
+		if o.Resume.VolumeID == "" {
+			return errors.New("missing volume of the resumed upload")
+		}
+		if o.Resume.Offset <= 0 || o.Resume.Offset >= o.Size || o.Resume.Offset%o.chunkSize() != 0 {
+			return fmt.Errorf("invalid offset %d of the resumed upload", int64(o.Resume.Offset))
+		}
+	}
+	return nil
+}
+
+// request returns the request creating the volume named name, fed with chunks chunks.
+func (o UploadOpts) request(name string, chunks int) schema.CreateStorageUploadRequest {
+	format := o.Format
+	if format == "" {
+		format = ImageFormatQCOW2
+	}
+	bus := o.Bus
+	if bus == "" {
+		bus = DiskBusVirtio
+	}
+	size := o.VolumeSize
+	if size == 0 {
+		size = int((o.Size + Gigabyte - 1) / Gigabyte)
+	}
+	return schema.CreateStorageUploadRequest{
+		Name:           name,
+		Size:           size,
+		Format:         string(format),
+		Bus:            string(bus),
+		Private:        o.Private,
+		Clonable:       true,
+		Alg:            string(CloneAlgCopy),
+		ImageSize:      int64(o.Size),
+		ExpectedChunks: chunks,
+		Labels:         o.Labels,
+	}
+}
+
+// chunkSize returns the size of the uploaded chunks.
+func (o UploadOpts) chunkSize() ByteSize {
+	if o.ChunkSize > 0 {
+		return o.ChunkSize
+	}
+	return defaultUploadChunkSize
+}
+
+// chunks returns the number of chunks the image is split in.
+func (o UploadOpts) chunks() int {
+	return int((o.Size + o.chunkSize() - 1) / o.chunkSize())
+}
+
+// Upload creates the volume name from the image read from r, exactly opts.Size
+// bytes long. The image is sent to the storage daemon in chunks, a failed chunk
+// is sent again up to opts.Retries times. If the upload still fails, an
+// *UploadError is returned and the volume is deleted, unless opts.Resumable is
+// set: the upload can then be resumed by calling Upload again with
+// opts.Resume set to the checkpoint of the error.
+//
+// Requires CapabilityVolumeUpload, see WithCapabilities.
+func (c *VolumeClient) Upload(ctx context.Context, name string, r io.Reader, opts UploadOpts) (*Volume, *Response, error) {
+	if name == "" {
+		return nil, nil, errors.New("missing name")
+	}
+	if err := c.client.requireCapability(CapabilityVolumeUpload); err != nil {
+		return nil, nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+	retries := opts.Retries
+	if retries == 0 {
+		retries = 3
+	}
+
+	chunks := opts.chunks()
+	reqBody := opts.request(name, chunks)
+	var volumeID string
+	var sent ByteSize
+	// Volumes already named name when the upload starts, which a lost
+	// response to the first chunk cannot have created
+	existing := map[string]bool{}
+	if opts.Resume != nil {
+		volumeID, sent = opts.Resume.VolumeID, opts.Resume.Offset
+	} else {
+		if _, err := c.client.CanCreateStorage(schema.CanCreateStorageRequest{Size: reqBody.Size}); err != nil {
+			return nil, nil, fmt.Errorf("the config provided cannot be created: %w", err)
+		}
+		volumes, err := c.list(VolumeListOpts{Name: name})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, vol := range volumes {
+			existing[vol.VolumeID] = true
+		}
+	}
+
+	// fail returns the error of a failed upload, deleting its volume unless
+	// the upload can be resumed
+	fail := func(err error) error {
+		if volumeID == "" {
+			return err
+		}
+		uploadErr := &UploadError{UploadCheckpoint: UploadCheckpoint{VolumeID: volumeID, Offset: sent}, Kept: opts.Resumable, Err: err}
+		if opts.Resumable {
+			return uploadErr
+		}
+		return c.discard(volumeID, uploadErr)
+	}
+
+	buf := make([]byte, opts.chunkSize())
+	for i := int(sent / opts.chunkSize()); i < chunks; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, fail(err)
+		}
+		length := opts.chunkSize()
+		if remaining := opts.Size - sent; remaining < length {
+			length = remaining
+		}
+		n, err := io.ReadFull(r, buf[:length])
+		if err != nil {
+			return nil, nil, fail(fmt.Errorf("failed to read chunk %d of the image: %w", i, err))
+		}
+		chunk := buf[:n]
+
+		attempt := 0
+		err = retry(ctx, retries, func() error {
+			attempt++
+			if volumeID == "" {
+				// The volume may have been created even if the response was lost
+				if attempt > 1 {
+					created, err := c.createdSince(name, existing)
+					if err != nil {
+						return permanentError{fmt.Errorf("volume %s may have been created, not retrying: %w", name, err)}
+					}
+					if created != "" {
+						// Deleted or kept as any volume of a failed upload
+						volumeID = created
+						return permanentError{fmt.Errorf("volume %s may have been created as %s, not retrying", name, created)}
+					}
+				}
+				resp, err := c.client.CreateStorageUpload(reqBody, chunk)
+				if err != nil {
+					return err
+				}
+				volumeID = resp.VolumeID
+				return nil
+			}
+			_, err := c.client.FeedStorageUpload(schema.FeedStorageUploadRequest{VolumeID: volumeID, Chunk: i, Offset: int64(sent)}, chunk)
+			return err
+		})
+		if err != nil {
+			return nil, nil, fail(fmt.Errorf("failed to upload chunk %d of the image: %w", i, err))
+		}
+
+		sent += ByteSize(n)
+		if opts.Progress != nil {
+			opts.Progress(UploadProgress{Sent: sent, Total: opts.Size})
+		}
+	}
+
+	if n, err := io.CopyN(io.Discard, r, 1); n > 0 {
+		return nil, nil, fail(fmt.Errorf("image is longer than %d bytes", int64(opts.Size)))
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fail(fmt.Errorf("failed to read the end of the image: %w", err))
+	}
+
+	vol, err := c.getSchemaByID(volumeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return VolumeFromSchema(*vol), &Response{}, nil
+}
+
+// createdSince returns the ID of a volume named name that is not in existing,
+// or an empty string if there is none.
+func (c *VolumeClient) createdSince(name string, existing map[string]bool) (string, error) {
+	volumes, err := c.list(VolumeListOpts{Name: name})
+	if err != nil {
+		return "", err
+	}
+	for _, vol := range volumes {
+		if !existing[vol.VolumeID] {
+			return vol.VolumeID, nil
+		}
+	}
+	return "", nil
+}
+
+// discard deletes the volume left by a failed operation, if it was created,
+// and returns the cause of the failure.
+func (c *VolumeClient) discard(volumeID string, cause error) error {
+	if volumeID == "" {
+		return cause
+	}
+	if _, err := c.client.DeleteStorage(schema.DeleteStorageRequest{VolumeID: volumeID}); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to delete volume %s: %w", volumeID, err))
+	}
+	return cause
+}
+
+// permanentError is an error retry does not retry.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// retry calls fn until it succeeds, at most retries more times, waiting a
+// second more after each attempt. It stops at the first permanentError, and
+// at the first error of an endpoint not supported by the daemons.
+func retry(ctx context.Context, retries int, fn func() error) error {
+	var errs []error
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if attempt == retries || errors.As(err, new(permanentError)) || IsError(err, ErrorUnsupportedError) {
+			return errors.Join(errs...)
+		}
+		if err := sleepContext(ctx, time.Duration(attempt+1)*time.Second); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+}
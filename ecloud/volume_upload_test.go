@@ -0,0 +1,303 @@
+package ecloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema"
+)
+
+func TestUploadOptsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    UploadOpts
+		wantErr bool
+	}{
+		{name: "Size only", opts: UploadOpts{Size: 600 * Megabyte}},
+		{name: "Raw", opts: UploadOpts{Size: 2 * Gigabyte, Format: ImageFormatRaw, VolumeSize: 2}},
+		{name: "Missing size", opts: UploadOpts{}, wantErr: true},
+		{name: "Unsupported format", opts: UploadOpts{Size: Gigabyte, Format: ImageFormatVMDK}, wantErr: true},
+		{name: "Volume smaller than raw image", opts: UploadOpts{Size: 3 * Gigabyte, Format: ImageFormatRaw, VolumeSize: 2}, wantErr: true},
+		{name: "Unsupported bus", opts: UploadOpts{Size: Gigabyte, Bus: "ide"}, wantErr: true},
+		{name: "Resume", opts: UploadOpts{Size: Gigabyte, Resume: &UploadCheckpoint{VolumeID: "v1", Offset: 16 * Megabyte}}},
+		{name: "Resume without volume", opts: UploadOpts{Size: Gigabyte, Resume: &UploadCheckpoint{Offset: 16 * Megabyte}}, wantErr: true},
+		{name: "Resume within a chunk", opts: UploadOpts{Size: Gigabyte, Resume: &UploadCheckpoint{VolumeID: "v1", Offset: Megabyte}}, wantErr: true},
+		{name: "Resume past the end", opts: UploadOpts{Size: Gigabyte, Resume: &UploadCheckpoint{VolumeID: "v1", Offset: Gigabyte}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadOptsRequest(t *testing.T) {
+	opts := UploadOpts{Size: 1536 * Megabyte, Private: true}
+	if chunks := opts.chunks(); chunks != 192 {
+		t.Errorf("chunks() = %d, want 192", chunks)
+	}
+
+	req := opts.request("debian-12", opts.chunks())
+	if req.Size != 2 || req.Format != "qcow2" || req.Bus != "virtio" || !req.Private {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if req.ImageSize != int64(1536*Megabyte) || req.ExpectedChunks != 192 {
+		t.Errorf("unexpected image size or chunks: %d, %d", req.ImageSize, req.ExpectedChunks)
+	}
+
+	if chunks := (UploadOpts{Size: 10, ChunkSize: 4}).chunks(); chunks != 3 {
+		t.Errorf("chunks() = %d, want 3", chunks)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	calls := 0
+	err := retry(ctx, 3, func() error {
+		calls++
+		return permanentError{errors.New("permanent")}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("retry() = %v after %d calls, want an error after 1 call", err, calls)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	err = retry(cancelled, 3, func() error {
+		calls++
+		return errors.New("failure")
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("retry() = %v after %d calls, want cancellation after 1 call", err, calls)
+	}
+
+	calls = 0
+	err = retry(ctx, 3, func() error {
+		calls++
+		return (&Client{}).requireCapability(CapabilityVolumeUpload)
+	})
+	if !IsError(err, ErrorUnsupportedError) || calls != 1 {
+		t.Errorf("retry() = %v after %d calls, want an unsupported error after 1 call", err, calls)
+	}
+
+	calls = 0
+	if err := retry(ctx, 3, func() error { calls++; return nil }); err != nil || calls != 1 {
+		t.Errorf("retry() = %v after %d calls, want success after 1 call", err, calls)
+	}
+}
+
+func TestUploadError(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := error(&UploadError{UploadCheckpoint: UploadCheckpoint{VolumeID: "v1", Offset: 16 * Megabyte}, Kept: true, Err: cause})
+
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) || uploadErr.VolumeID != "v1" || uploadErr.Offset != 16*Megabyte {
+		t.Fatalf("expected the checkpoint of the upload, got %v", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expected the error to wrap its cause")
+	}
+
+	// The checkpoint resumes the upload
+	opts := UploadOpts{Size: Gigabyte, Resume: &uploadErr.UploadCheckpoint}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+}
+
+// fakeStorage is a storage daemon serving the routes of an upload, failing
+// the chunks listed in failures as many times as their count.
+type fakeStorage struct {
+	mu       sync.Mutex
+	volumes  map[string][]byte // Content by ID
+	names    map[string]string // Name by ID
+	failures map[int]int       // Failures left by chunk index
+	lostCall bool              // Whether the response creating a volume is lost once
+	deleted  []string
+}
+
+func (f *fakeStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/api/v1.0/client/volume/cancreate":
+		fmt.Fprint(w, "1")
+	case r.URL.Path == "/api/v1.0/client/volume/accessible":
+		volumes := schema.GetStorageResponse{}
+		for id, name := range f.names {
+			volumes = append(volumes, schema.StorageVolume{VolumeID: id, Name: name, Own: true})
+		}
+		json.NewEncoder(w).Encode(volumes)
+	case r.URL.Path == "/api/v1.0/client/volume/info":
+		var req schema.GetStorageByIDRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if _, ok := f.volumes[req.VolumeID]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(schema.GetStorageByIDResponse{Volume: schema.StorageVolume{VolumeID: req.VolumeID, Name: f.names[req.VolumeID], Own: true}})
+	case r.URL.Path == "/api/v1.0/client/volume/destroy":
+		var req schema.DeleteStorageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		delete(f.volumes, req.VolumeID)
+		delete(f.names, req.VolumeID)
+		f.deleted = append(f.deleted, req.VolumeID)
+		fmt.Fprint(w, "{}")
+	case strings.HasPrefix(r.URL.Path, "/api/v1.0/client/volume/image/upload/"):
+		payload, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, "/api/v1.0/client/volume/image/upload/"))
+		var feed schema.FeedStorageUploadRequest
+		json.Unmarshal(payload, &feed)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chunk, _ := io.ReadAll(file)
+
+		if f.failures[feed.Chunk] > 0 {
+			f.failures[feed.Chunk]--
+			http.Error(w, "chunk lost", http.StatusInternalServerError)
+			return
+		}
+		if feed.VolumeID == "" {
+			var create schema.CreateStorageUploadRequest
+			json.Unmarshal(payload, &create)
+			id := fmt.Sprintf("v%d", len(f.names)+len(f.deleted)+1)
+			f.volumes[id], f.names[id] = chunk, create.Name
+			if f.lostCall {
+				f.lostCall = false
+				http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+				return
+			}
+			json.NewEncoder(w).Encode(schema.CreateStorageUploadResponse{VolumeID: id})
+			return
+		}
+		data, ok := f.volumes[feed.VolumeID]
+		if !ok || int64(len(data)) != feed.Offset {
+			http.Error(w, "unexpected offset", http.StatusConflict)
+			return
+		}
+		f.volumes[feed.VolumeID] = append(data, chunk...)
+		w.WriteHeader(http.StatusPartialContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// redirectTransport sends the requests to the daemons to host.
+type redirectTransport struct {
+	host string
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Host = t.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newFakeStorageClient returns a client whose storage daemon is storage.
+func newFakeStorageClient(t *testing.T, storage *fakeStorage) *Client {
+	t.Helper()
+	server := httptest.NewServer(storage)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient("test", "1", WithCapabilities(CapabilityVolumeUpload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.httpClient = &http.Client{Transport: redirectTransport{host: server.Listener.Addr().String()}}
+	return client
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	image := bytes.Repeat([]byte("0123456789"), 4) // 4 chunks of 10 bytes
+	opts := UploadOpts{Size: ByteSize(len(image)), ChunkSize: 10, Retries: 1}
+
+	t.Run("Failed chunk retried", func(t *testing.T) {
+		storage := &fakeStorage{volumes: map[string][]byte{}, names: map[string]string{}, failures: map[int]int{2: 1}}
+		client := newFakeStorageClient(t, storage)
+
+		vol, _, err := client.Volume.Upload(ctx, "debian-12", bytes.NewReader(image), opts)
+		if err != nil {
+			t.Fatalf("Upload() returned error: %v", err)
+		}
+		if !bytes.Equal(storage.volumes[vol.ID], image) {
+			t.Errorf("volume holds %q, want %q", storage.volumes[vol.ID], image)
+		}
+	})
+
+	t.Run("Resumed from a checkpoint", func(t *testing.T) {
+		storage := &fakeStorage{volumes: map[string][]byte{}, names: map[string]string{}, failures: map[int]int{2: 2}}
+		client := newFakeStorageClient(t, storage)
+
+		resumable := opts
+		resumable.Resumable = true
+		_, _, err := client.Volume.Upload(ctx, "debian-12", bytes.NewReader(image), resumable)
+		var uploadErr *UploadError
+		if !errors.As(err, &uploadErr) || !uploadErr.Kept || uploadErr.Offset != 20 {
+			t.Fatalf("Upload() = %v, want a kept volume with a checkpoint at byte 20", err)
+		}
+		if len(storage.deleted) != 0 {
+			t.Fatalf("the volume of a resumable upload was deleted: %v", storage.deleted)
+		}
+
+		resumable.Resume = &uploadErr.UploadCheckpoint
+		vol, _, err := client.Volume.Upload(ctx, "debian-12", bytes.NewReader(image[uploadErr.Offset:]), resumable)
+		if err != nil {
+			t.Fatalf("Upload() returned error on resume: %v", err)
+		}
+		if vol.ID != uploadErr.VolumeID || !bytes.Equal(storage.volumes[vol.ID], image) {
+			t.Errorf("volume %s holds %q, want %s holding %q", vol.ID, storage.volumes[vol.ID], uploadErr.VolumeID, image)
+		}
+	})
+
+	t.Run("Lost response creating the volume", func(t *testing.T) {
+		storage := &fakeStorage{
+			volumes:  map[string][]byte{"v0": nil},
+			names:    map[string]string{"v0": "debian-12"}, // An earlier volume with the same name
+			failures: map[int]int{},
+			lostCall: true,
+		}
+		client := newFakeStorageClient(t, storage)
+
+		_, _, err := client.Volume.Upload(ctx, "debian-12", bytes.NewReader(image), opts)
+		var uploadErr *UploadError
+		if !errors.As(err, &uploadErr) || uploadErr.VolumeID == "v0" {
+			t.Fatalf("Upload() = %v, want an error on the created volume", err)
+		}
+		if len(storage.names) != 1 || storage.names["v0"] == "" {
+			t.Errorf("expected the created volume to be deleted and no other created, volumes: %v", storage.names)
+		}
+	})
+
+	t.Run("Volume deleted unless resumable", func(t *testing.T) {
+		storage := &fakeStorage{volumes: map[string][]byte{}, names: map[string]string{}, failures: map[int]int{1: 2}}
+		client := newFakeStorageClient(t, storage)
+
+		_, _, err := client.Volume.Upload(ctx, "debian-12", bytes.NewReader(image), opts)
+		var uploadErr *UploadError
+		if !errors.As(err, &uploadErr) || uploadErr.Kept {
+			t.Fatalf("Upload() = %v, want an upload error without a kept volume", err)
+		}
+		if len(storage.deleted) != 1 || storage.deleted[0] != uploadErr.VolumeID || len(storage.volumes) != 0 {
+			t.Errorf("expected volume %s to be deleted, deleted %v", uploadErr.VolumeID, storage.deleted)
+		}
+	})
+}
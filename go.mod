@@ -6,6 +6,9 @@ replace github.com/Elemento-Modular-Cloud/tesi-paolobeci => ../tesi-paolobeci
 
 replace github.com/Elemento-Modular-Cloud/tesi-paolobeci/ecloud/schema => ../tesi-paolobeci/ecloud/schema
 
-require golang.org/x/crypto v0.38.0
+require (
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.38.0
+)
 
 require golang.org/x/sys v0.33.0 // indirect